@@ -1,13 +1,16 @@
 package diff
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"sort"
 
 	"github.com/arithran/jsondiff"
-	"github.com/hashicorp/go-retryablehttp"
 	"github.com/itchyny/gojq"
 )
 
@@ -15,10 +18,15 @@ var opts jsondiff.Options
 
 type (
 	result struct {
-		e      test
-		Before output
-		After  output
-		Diffs  []diff
+		e          test
+		Before     output
+		After      output
+		Candidates []output
+		Diffs      []diff
+		Agree      []string   // targets that agree with the majority
+		Diverge    []string   // targets that diverge from the majority
+		Accepted   []accepted // differences accepted by the baseline
+		err        error
 	}
 	diff struct {
 		Field string
@@ -26,102 +34,241 @@ type (
 	}
 )
 
-func exec(ctx context.Context, c httpClient, t test,
+func exec(ctx context.Context, targets []*target, t test,
 	ignore map[string]struct{}, wantMatch jsondiff.Difference, jq *gojq.Query) (result, error) {
 	var err error
 	res := result{
 		e: t,
 	}
 
-	res.Before, err = newOutput(ctx, c, t.Before, jq)
+	res.Before, err = newOutput(ctx, targets[0], t.Before, outputJq(t, jq))
+	res.Before.err = err
+	if err != nil && !isDecodeError(err) {
+		return res, err
+	}
+	// the other targets are still sent when before can't be decoded, so
+	// that all their responses can be validated
+	res, afterErr := fetchAfter(ctx, targets, res, jq)
+	if afterErr != nil && (err == nil || !isDecodeError(afterErr)) {
+		err = afterErr
+	}
 	if err != nil {
 		return res, err
 	}
-	res.After, err = newOutput(ctx, c, t.After, jq)
+	return compareResult(res, ignore, wantMatch, jq)
+}
+
+// execAfter compares the before output of a result with the outputs of after
+// and the candidates
+func execAfter(ctx context.Context, targets []*target, res result,
+	ignore map[string]struct{}, wantMatch jsondiff.Difference, jq *gojq.Query) (result, error) {
+	res, err := fetchAfter(ctx, targets, res, jq)
 	if err != nil {
 		return res, err
 	}
+	return compareResult(res, ignore, wantMatch, jq)
+}
+
+// fetchAfter sends a test to after and the candidates. A response that can't
+// be decoded doesn't stop the others, the first decode error is returned
+// after all of them were sent. A candidate that fails doesn't fail the
+// result, it diverges from the vote of the others.
+func fetchAfter(ctx context.Context, targets []*target, res result, jq *gojq.Query) (result, error) {
+	t := res.e
+
+	var decodeErr error
+	o, err := newOutput(ctx, targets[1], t.After, outputJq(t, jq))
+	o.err = err
+	res.After = o
+	if err != nil {
+		if !isDecodeError(err) {
+			return res, err
+		}
+		decodeErr = err
+	}
+	for n, i := range t.Candidates {
+		o, err := newOutput(ctx, targets[2+n], i, outputJq(t, jq))
+		o.err = err
+		res.Candidates = append(res.Candidates, o)
+		if errors.Is(err, context.Canceled) {
+			return res, err
+		}
+	}
+	return res, decodeErr
+}
+
+// compareResult compares the outputs of a result
+func compareResult(res result, ignore map[string]struct{}, wantMatch jsondiff.Difference, jq *gojq.Query) (result, error) {
+	var err error
+	t := res.e
+
+	outputs := append([]output{res.Before, res.After}, res.Candidates...)
+	if t.GraphQL {
+		// candidates that failed have no response to decode
+		received := []int{}
+		decoded := []output{}
+		for i, o := range outputs {
+			if o.err == nil {
+				received = append(received, i)
+				decoded = append(decoded, o)
+			}
+		}
+		ignore, err = graphQLOutputs(decoded, graphQLOperationName(t.Before.Body), ignore, wantMatch, jq)
+		if err != nil {
+			return res, err
+		}
+		for n, i := range received {
+			outputs[i] = decoded[n]
+		}
+		res.Before, res.After = outputs[0], outputs[1]
+		copy(res.Candidates, outputs[2:])
+	}
+
+	if len(res.Candidates) == 0 {
+		res.Diffs = compareOutputs(res.Before, res.After, ignore, wantMatch)
+		return res, nil
+	}
 
-	// calculate diff only if status codes are equal
-	if res.Before.Code == res.After.Code {
-		for k, v := range res.Before.Body {
+	res.Agree, res.Diverge, res.Diffs = vote(outputs, targetNames(len(outputs)), ignore, wantMatch)
+	return res, nil
+}
+
+// outputJq returns the jq query of the outputs of a test. GraphQL responses
+// apply it to their data instead, see graphQLOutputs.
+func outputJq(t test, jq *gojq.Query) *gojq.Query {
+	if t.GraphQL {
+		return nil
+	}
+	return jq
+}
+
+// compareOutputs returns the differences between two outputs. The body is
+// only diffed when the status codes are equal.
+func compareOutputs(before, after output, ignore map[string]struct{}, wantMatch jsondiff.Difference) []diff {
+	var diffs []diff
+
+	if before.Code == after.Code {
+		for k, v := range before.Body {
 			if _, ok := ignore[k]; ok {
 				continue
 			}
 
-			match, delta := jsondiff.Compare(res.After.Body[k], v, &opts)
-			if match > wantMatch {
-				res.Diffs = append(res.Diffs, diff{
+			want := wantMatch
+			if _, ok := before.Exact[k]; ok {
+				want = jsondiff.FullMatch
+			}
+			match, delta := jsondiff.Compare(after.Body[k], v, &opts)
+			if match > want {
+				diffs = append(diffs, diff{
 					Field: k,
 					Delta: cleanDiff(delta),
 				})
 			}
 		}
 	} else {
-		res.Diffs = append(res.Diffs, diff{
+		diffs = append(diffs, diff{
 			Field: "_http.StatusCode",
-			Delta: fmt.Sprintf("StatusCodes didn't match,\n before: %s\n after : %s", res.Before.Code, res.After.Code),
+			Delta: fmt.Sprintf("StatusCodes didn't match,\n before: %s\n after : %s", before.Code, after.Code),
 		})
 	}
 
-	sort.Slice(res.Diffs, func(i, j int) bool {
-		return res.Diffs[i].Field < res.Diffs[j].Field
+	sort.Slice(diffs, func(i, j int) bool {
+		return diffs[i].Field < diffs[j].Field
 	})
-	return res, nil
+	return diffs
 }
 
 type output struct {
-	Code string
-	Body map[string]json.RawMessage
+	Code        string
+	ContentType string
+	Proto       string // the negotiated protocol, i.e. HTTP/2.0
+	Body        map[string]json.RawMessage
+	Exact       map[string]struct{} // fields that must match exactly, regardless of --match
+	Raw         []byte              // the response body before it's decoded
+	err         error               // the response couldn't be received or decoded
 }
 
-func newOutput(ctx context.Context, c httpClient, i input, jq *gojq.Query) (output, error) {
-	o := output{}
+// decodeError is returned by newOutput when a response was received but its
+// body isn't JSON, i.e. an HTML error page
+type decodeError struct {
+	err error
+}
 
-	// request
-	var err error
-	var req *retryablehttp.Request
-	if i.Body != "" {
-		req, err = retryablehttp.NewRequest(i.Method, i.Path, []byte(i.Body))
-	} else {
-		req, err = retryablehttp.NewRequest(i.Method, i.Path, nil)
+func (e *decodeError) Error() string {
+	return e.err.Error()
+}
+
+func (e *decodeError) Unwrap() error {
+	return e.err
+}
+
+// isDecodeError reports whether err is a decodeError
+func isDecodeError(err error) bool {
+	var de *decodeError
+	return errors.As(err, &de)
+}
+
+func newOutput(ctx context.Context, t *target, i input, jq *gojq.Query) (output, error) {
+	if t.grpc != nil {
+		return newGRPCOutput(ctx, t, i, jq)
 	}
-	if err != nil {
-		return o, err
+	if i.Stream != nil {
+		return newStreamOutput(ctx, t, i, jq)
 	}
-	for k, v := range i.Headers {
-		req.Header.Add(k, v)
+	if i.Paginate != nil {
+		return newPagedOutput(ctx, t, i, jq)
 	}
 
-	// response
-	httpTraceReq(req)
-	resp, err := c.Do(req.WithContext(ctx))
+	o := output{}
+	resp, err := t.do(ctx, i)
 	if err != nil {
 		return o, err
 	}
-	httpTraceResp(resp)
 
 	// decode
 	o.Code = resp.Status
+	o.Proto = resp.Proto
+	o.ContentType = resp.Header.Get("Content-Type")
 	defer resp.Body.Close()
+	o.Raw, err = ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return o, err
+	}
+	// a response without a body, i.e. 204 No Content, has no fields
+	if len(bytes.TrimSpace(o.Raw)) == 0 {
+		o.Body = map[string]json.RawMessage{}
+		return o, nil
+	}
+	o.Body, err = decodeBody(o.Raw, jq)
+	var syntaxErr *json.SyntaxError
+	if errors.As(err, &syntaxErr) || errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return o, &decodeError{err: err}
+	}
+	if err != nil {
+		return o, err
+	}
+
+	return o, nil
+}
+
+// decodeBody decodes a JSON response body into its top level fields, or
+// the fields of the jq matches when a query is given
+func decodeBody(raw []byte, jq *gojq.Query) (map[string]json.RawMessage, error) {
 	if jq != nil {
 		var body interface{}
-		err = json.NewDecoder(resp.Body).Decode(&body)
+		err := json.NewDecoder(bytes.NewReader(raw)).Decode(&body)
 		if err != nil {
-			return o, err
-		}
-		o.Body, err = applyJqQueryToBody(jq, body)
-		if err != nil {
-			return o, err
-		}
-	} else {
-		err = json.NewDecoder(resp.Body).Decode(&o.Body)
-		if err != nil {
-			return o, err
+			return nil, err
 		}
+		return applyJqQueryToBody(jq, body)
 	}
 
-	return o, nil
+	var body map[string]json.RawMessage
+	err := json.NewDecoder(bytes.NewReader(raw)).Decode(&body)
+	if err != nil {
+		return nil, err
+	}
+	return body, nil
 }
 
 func init() {
@@ -0,0 +1,302 @@
+package diff
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	osexec "os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/go-retryablehttp"
+	"github.com/itchyny/gojq"
+	log "github.com/sirupsen/logrus"
+)
+
+// Auth types supported by auth config files
+const (
+	AuthOAuth2  = "oauth2"
+	AuthLogin   = "login"
+	AuthCommand = "command"
+)
+
+// expirySkew refreshes tokens before they expire
+const expirySkew = 30 * time.Second
+
+type (
+	// authConfig is the auth config file of a target, i.e.
+	//
+	//	type: oauth2
+	//	token_url: https://auth.example.com/oauth/token
+	//	client_id: apicmp
+	//	client_secret: ${CLIENT_SECRET}
+	authConfig struct {
+		Type string `json:"type"`
+
+		// oauth2 client credentials flow. ${ENV} variables are expanded.
+		TokenURL     string   `json:"token_url"`
+		ClientID     string   `json:"client_id"`
+		ClientSecret string   `json:"client_secret"`
+		Scopes       []string `json:"scopes"`
+		ClientAuth   string   `json:"client_auth"` // header (default) or body
+
+		// login request, the path is relative to the target unless it's a url
+		Login     *Fixture `json:"login"`
+		Token     string   `json:"token"`      // jq, default: .access_token
+		ExpiresIn string   `json:"expires_in"` // jq, seconds, default: .expires_in
+
+		// command that prints a token, run with sh -c
+		Command string `json:"command"`
+
+		Header string  `json:"header"` // default: Authorization
+		Prefix *string `json:"prefix"` // default: "Bearer "
+		TTL    string  `json:"ttl"`    // lifetime of tokens without an expiry
+	}
+
+	// tokenSource caches the token of a target until it expires or is rejected
+	tokenSource struct {
+		header string
+		prefix string
+		ttl    time.Duration
+		fetch  func(ctx context.Context) (string, time.Duration, error)
+
+		mu     sync.Mutex
+		token  string
+		expiry time.Time // zero when the token doesn't expire
+	}
+)
+
+func newTokenSource(path string, t *target) (*tokenSource, error) {
+	var c authConfig
+	if err := readYAMLFile(path, &c); err != nil {
+		return nil, err
+	}
+
+	s := &tokenSource{
+		header: "Authorization",
+		prefix: "Bearer ",
+	}
+	if c.Header != "" {
+		s.header = c.Header
+	}
+	if c.Prefix != nil {
+		s.prefix = *c.Prefix
+	}
+	if c.TTL != "" {
+		ttl, err := time.ParseDuration(c.TTL)
+		if err != nil {
+			return nil, fmt.Errorf("ttl: %w", err)
+		}
+		s.ttl = ttl
+	}
+
+	switch c.Type {
+	case AuthOAuth2:
+		if c.TokenURL == "" {
+			return nil, errors.New("token_url is required")
+		}
+		s.fetch = func(ctx context.Context) (string, time.Duration, error) {
+			return fetchClientCredentials(ctx, t.client, c)
+		}
+
+	case AuthLogin:
+		if c.Login == nil {
+			return nil, errors.New("login is required")
+		}
+		setDefaultHeaders(c.Login.Headers)
+		token, err := parseQuery(c.Token, ".access_token")
+		if err != nil {
+			return nil, fmt.Errorf("token: %w", err)
+		}
+		expiresIn, err := parseQuery(c.ExpiresIn, ".expires_in")
+		if err != nil {
+			return nil, fmt.Errorf("expires_in: %w", err)
+		}
+		s.fetch = func(ctx context.Context) (string, time.Duration, error) {
+			return fetchLogin(ctx, t, *c.Login, token, expiresIn)
+		}
+
+	case AuthCommand:
+		if c.Command == "" {
+			return nil, errors.New("command is required")
+		}
+		s.fetch = func(ctx context.Context) (string, time.Duration, error) {
+			out, err := osexec.CommandContext(ctx, "sh", "-c", c.Command).Output()
+			if err != nil {
+				return "", 0, fmt.Errorf("command: %w", err)
+			}
+			return strings.TrimSpace(string(out)), 0, nil
+		}
+
+	default:
+		return nil, fmt.Errorf("unsupported auth type %q", c.Type)
+	}
+
+	return s, nil
+}
+
+// Token returns the cached token or fetches a new one
+func (s *tokenSource) Token(ctx context.Context) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.token != "" && (s.expiry.IsZero() || time.Now().Before(s.expiry)) {
+		return s.token, nil
+	}
+
+	token, expiresIn, err := s.fetch(ctx)
+	if err != nil {
+		return "", err
+	}
+	if token == "" {
+		return "", errors.New("auth: empty token")
+	}
+	if expiresIn == 0 {
+		expiresIn = s.ttl
+	}
+
+	s.token, s.expiry = token, time.Time{}
+	if expiresIn > 0 {
+		skew := expirySkew
+		if expiresIn < 2*skew {
+			skew = expiresIn / 10
+		}
+		s.expiry = time.Now().Add(expiresIn - skew)
+	}
+	log.Debugf("auth: fetched a new token, expires in %v", expiresIn)
+	return s.token, nil
+}
+
+// invalidate forgets a token that was rejected, unless it was already refreshed
+func (s *tokenSource) invalidate(token string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.token == token {
+		s.token = ""
+	}
+}
+
+// fetchClientCredentials requests a token with the OAuth2 client credentials
+// grant, see RFC 6749 section 4.4
+func fetchClientCredentials(ctx context.Context, client httpClient, c authConfig) (string, time.Duration, error) {
+	clientID, clientSecret := os.ExpandEnv(c.ClientID), os.ExpandEnv(c.ClientSecret)
+
+	form := url.Values{"grant_type": {"client_credentials"}}
+	if len(c.Scopes) > 0 {
+		form.Set("scope", strings.Join(c.Scopes, " "))
+	}
+	if c.ClientAuth == "body" {
+		form.Set("client_id", clientID)
+		form.Set("client_secret", clientSecret)
+	}
+
+	req, err := retryablehttp.NewRequest(http.MethodPost, os.ExpandEnv(c.TokenURL), []byte(form.Encode()))
+	if err != nil {
+		return "", 0, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if c.ClientAuth != "body" {
+		req.SetBasicAuth(url.QueryEscape(clientID), url.QueryEscape(clientSecret))
+	}
+
+	resp, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		return "", 0, err
+	}
+	defer resp.Body.Close()
+
+	raw, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return "", 0, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", 0, fmt.Errorf("token request: %s: %s", resp.Status, raw)
+	}
+
+	var token struct {
+		AccessToken string  `json:"access_token"`
+		ExpiresIn   float64 `json:"expires_in"`
+	}
+	if err := json.Unmarshal(raw, &token); err != nil {
+		return "", 0, fmt.Errorf("token response: %w", err)
+	}
+	return token.AccessToken, time.Duration(token.ExpiresIn * float64(time.Second)), nil
+}
+
+// fetchLogin sends a login request to a target and captures the token of
+// its response with jq
+func fetchLogin(ctx context.Context, t *target, login Fixture, token, expiresIn *gojq.Query) (string, time.Duration, error) {
+	login, err := renderFixture(login, map[string]interface{}{}, newFixtureFuncs(time.Now().UnixNano(), time.Now()))
+	if err != nil {
+		return "", 0, err
+	}
+
+	path := login.Path
+	if !strings.Contains(path, "://") {
+		path = t.base + path
+	}
+
+	var body []byte
+	if login.Body != "" {
+		body = []byte(login.Body)
+	}
+	req, err := retryablehttp.NewRequest(login.Method, path, body)
+	if err != nil {
+		return "", 0, err
+	}
+	for k, v := range login.Headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := t.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return "", 0, err
+	}
+	defer resp.Body.Close()
+
+	raw, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return "", 0, err
+	}
+	if resp.StatusCode >= http.StatusBadRequest {
+		return "", 0, fmt.Errorf("login request: %s: %s", resp.Status, raw)
+	}
+
+	var v interface{}
+	if err := json.Unmarshal(raw, &v); err != nil {
+		return "", 0, fmt.Errorf("login response: %w", err)
+	}
+
+	tok, ok := token.Run(v).Next()
+	s, isString := tok.(string)
+	if !ok || !isString {
+		return "", 0, fmt.Errorf("login response: no token: %v", tok)
+	}
+
+	var ttl time.Duration
+	if exp, ok := expiresIn.Run(v).Next(); ok {
+		switch n := exp.(type) {
+		case float64:
+			ttl = time.Duration(n * float64(time.Second))
+		case int:
+			ttl = time.Duration(n) * time.Second
+		}
+	}
+	return s, ttl, nil
+}
+
+// parseQuery parses a jq expression or the default expression when empty
+func parseQuery(expr, def string) (*gojq.Query, error) {
+	if expr == "" {
+		expr = def
+	}
+	return gojq.Parse(expr)
+}
@@ -0,0 +1,189 @@
+package diff
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// newTokenServer returns an OAuth2 token server and an API that accepts the
+// latest token only
+func newTokenServer(t *testing.T) (*httptest.Server, *int32) {
+	var issued int32
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/oauth/token", func(w http.ResponseWriter, r *http.Request) {
+		id, secret, ok := r.BasicAuth()
+		if !ok || id != "apicmp" || secret != "s3cret" || r.FormValue("grant_type") != "client_credentials" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		assert.Equal(t, "read write", r.FormValue("scope"))
+
+		n := atomic.AddInt32(&issued, 1)
+		fmt.Fprintf(w, `{"access_token": "token%d", "token_type": "bearer", "expires_in": 3600}`, n)
+	})
+	mux.HandleFunc("/login", func(w http.ResponseWriter, r *http.Request) {
+		var body struct{ User string }
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.User != "apicmp" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		n := atomic.AddInt32(&issued, 1)
+		fmt.Fprintf(w, `{"data": {"jwt": "token%d"}}`, n)
+	})
+	mux.HandleFunc("/me", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != fmt.Sprintf("Bearer token%d", atomic.LoadInt32(&issued)) {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		fmt.Fprint(w, `{"name": "apicmp"}`)
+	})
+
+	return httptest.NewServer(mux), &issued
+}
+
+func Test_tokenSource(t *testing.T) {
+	server, issued := newTokenServer(t)
+	defer server.Close()
+
+	dir, err := ioutil.TempDir("", "apicmp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	os.Setenv("APICMP_TEST_SECRET", "s3cret")
+	defer os.Unsetenv("APICMP_TEST_SECRET")
+
+	tests := []struct {
+		name   string
+		config string
+	}{
+		{
+			name: "oauth2",
+			config: "type: oauth2\n" +
+				"token_url: " + server.URL + "/oauth/token\n" +
+				"client_id: apicmp\n" +
+				"client_secret: ${APICMP_TEST_SECRET}\n" +
+				"scopes: [read, write]\n",
+		},
+		{
+			name: "login",
+			config: "type: login\n" +
+				"login: {method: POST, path: /login, body: {\"user\": \"apicmp\"}}\n" +
+				"token: .data.jwt\n",
+		},
+		{
+			name:   "command",
+			config: "type: command\ncommand: echo token$(cat " + filepath.Join(dir, "issued") + ")\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			atomic.StoreInt32(issued, 0)
+			path := filepath.Join(dir, "auth.yaml")
+			if err := ioutil.WriteFile(path, []byte(tt.config), 0644); err != nil {
+				t.Fatal(err)
+			}
+			// the command prints the token that the server expects
+			if err := ioutil.WriteFile(filepath.Join(dir, "issued"), []byte("0"), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			targets, err := newTargets(Config{
+				BeforeBasePath: server.URL,
+				AfterBasePath:  server.URL,
+				Targets:        map[string]TargetConfig{"after": {AuthFilePath: path}},
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			after := targets[1]
+			assert.Nil(t, targets[0].auth)
+
+			i := input{Method: "GET", Path: server.URL + "/me", Headers: map[string]string{}}
+			o, err := newOutput(context.Background(), after, i, nil)
+			assert.NoError(t, err)
+			assert.Equal(t, "200 OK", o.Code)
+			assert.Empty(t, i.Headers, "the token isn't added to the input")
+
+			// the token is cached
+			token, err := after.auth.Token(context.Background())
+			assert.NoError(t, err)
+			assert.Equal(t, after.auth.token, token)
+		})
+	}
+}
+
+func Test_tokenSourceRefresh(t *testing.T) {
+	fetched := 0
+	s := &tokenSource{
+		fetch: func(ctx context.Context) (string, time.Duration, error) {
+			fetched++
+			return fmt.Sprintf("token%d", fetched), 100 * time.Millisecond, nil
+		},
+	}
+
+	token, _ := s.Token(context.Background())
+	assert.Equal(t, "token1", token)
+	token, _ = s.Token(context.Background())
+	assert.Equal(t, "token1", token)
+
+	// expired
+	time.Sleep(100 * time.Millisecond)
+	token, _ = s.Token(context.Background())
+	assert.Equal(t, "token2", token)
+
+	// rejected
+	s.invalidate("token1")
+	token, _ = s.Token(context.Background())
+	assert.Equal(t, "token2", token)
+	s.invalidate("token2")
+	token, _ = s.Token(context.Background())
+	assert.Equal(t, "token3", token)
+}
+
+func Test_targetRefreshesRejectedToken(t *testing.T) {
+	server, issued := newTokenServer(t)
+	defer server.Close()
+
+	client, err := newRetriableHTTPClient(nil, TargetConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tokens := 0
+	target := &target{
+		name:   "after",
+		client: client,
+		auth: &tokenSource{
+			header: "Authorization",
+			prefix: "Bearer ",
+			fetch: func(ctx context.Context) (string, time.Duration, error) {
+				tokens++
+				return fmt.Sprintf("token%d", tokens), 0, nil
+			},
+		},
+	}
+
+	// the server issued a second token, so the first one is rejected
+	atomic.StoreInt32(issued, 2)
+	tokens = 1
+	target.auth.token = "token1"
+
+	o, err := newOutput(context.Background(), target, input{Method: "GET", Path: server.URL + "/me"}, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "200 OK", o.Code)
+	assert.Equal(t, 2, tokens)
+}
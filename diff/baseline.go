@@ -0,0 +1,246 @@
+package diff
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v3"
+)
+
+const baselineDateFormat = "2006-01-02"
+
+type (
+	// baselineFile lists accepted differences, i.e.
+	//
+	//	accepted:
+	//	  - route: GET /users/{id}
+	//	    fields: [price]
+	//	    reason: the old service rounds prices
+	//	    expires: 2026-12-31
+	//	  - rows: [12, 40]
+	//	    fields: ["_schema.*"]
+	//
+	// An entry matches the rows or the route, or every row when neither is
+	// set. Fields and routes match with * as a wildcard.
+	baselineFile struct {
+		Accepted []baselineEntry `json:"accepted" yaml:"accepted"`
+	}
+
+	baselineEntry struct {
+		Rows    []int    `json:"rows,omitempty" yaml:"rows,omitempty,flow"`
+		Route   string   `json:"route,omitempty" yaml:"route,omitempty"` // method and normalized path, see --sample
+		Fields  []string `json:"fields" yaml:"fields,flow"`
+		Reason  string   `json:"reason,omitempty" yaml:"reason,omitempty"`
+		Expires string   `json:"expires,omitempty" yaml:"expires,omitempty"` // the last day it's accepted, YYYY-MM-DD
+	}
+
+	// accepted is a difference that's accepted by the baseline
+	accepted struct {
+		Field  string
+		Reason string
+	}
+
+	// baseline accepts the differences of a baseline file
+	baseline struct {
+		path    string
+		file    baselineFile
+		entries []baselineMatcher
+	}
+
+	baselineMatcher struct {
+		rows    map[int]struct{}
+		route   *regexp.Regexp
+		fields  []*regexp.Regexp
+		reason  string
+		expires time.Time // zero when it never expires
+	}
+)
+
+// loadBaseline reads a baseline file. A missing file is an empty baseline,
+// because baseline update creates it.
+func loadBaseline(path string) (*baseline, error) {
+	b := &baseline{path: path}
+	if _, err := os.Stat(path); err == nil {
+		if err := readYAMLFile(path, &b.file); err != nil {
+			return nil, err
+		}
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	now := time.Now()
+	for n, e := range b.file.Accepted {
+		// yaml decodes unquoted dates as timestamps
+		if len(e.Expires) > len(baselineDateFormat) {
+			e.Expires = e.Expires[:len(baselineDateFormat)]
+			b.file.Accepted[n].Expires = e.Expires
+		}
+		m, err := newBaselineMatcher(e)
+		if err != nil {
+			return nil, fmt.Errorf("entry #%d: %w", n+1, err)
+		}
+		if m.expired(now) {
+			log.Warnf("baseline: entry #%d (%s) expired on %s", n+1, strings.Join(e.Fields, ","), e.Expires)
+		}
+		b.entries = append(b.entries, m)
+	}
+	return b, nil
+}
+
+func newBaselineMatcher(e baselineEntry) (baselineMatcher, error) {
+	if len(e.Fields) == 0 {
+		return baselineMatcher{}, fmt.Errorf("fields are required")
+	}
+
+	m := baselineMatcher{reason: e.Reason}
+	if len(e.Rows) > 0 {
+		m.rows = make(map[int]struct{}, len(e.Rows))
+		for _, row := range e.Rows {
+			m.rows[row] = struct{}{}
+		}
+	}
+	if e.Route != "" {
+		m.route = wildcard(e.Route)
+	}
+	for _, f := range e.Fields {
+		m.fields = append(m.fields, wildcard(f))
+	}
+
+	if e.Expires != "" {
+		t, err := time.ParseInLocation(baselineDateFormat, e.Expires, time.Local)
+		if err != nil {
+			return baselineMatcher{}, fmt.Errorf("invalid expires %q, expected YYYY-MM-DD", e.Expires)
+		}
+		m.expires = t.AddDate(0, 0, 1)
+	}
+	return m, nil
+}
+
+// wildcard returns a regexp of a pattern where * matches anything
+func wildcard(pattern string) *regexp.Regexp {
+	parts := strings.Split(pattern, "*")
+	for i, p := range parts {
+		parts[i] = regexp.QuoteMeta(p)
+	}
+	return regexp.MustCompile("^" + strings.Join(parts, ".*") + "$")
+}
+
+func (m baselineMatcher) expired(now time.Time) bool {
+	return !m.expires.IsZero() && !now.Before(m.expires)
+}
+
+func (m baselineMatcher) matches(t test, field string) bool {
+	if m.rows != nil {
+		if _, ok := m.rows[t.Row]; !ok {
+			return false
+		}
+	}
+	if m.route != nil && !m.route.MatchString(t.Route) {
+		return false
+	}
+	for _, f := range m.fields {
+		if f.MatchString(field) {
+			return true
+		}
+	}
+	return false
+}
+
+// accept returns the differences that aren't accepted, and the ones that
+// are. Expired entries don't accept anything.
+func (b *baseline) accept(t test, diffs []diff, now time.Time) ([]diff, []accepted) {
+	var failed []diff
+	var ok []accepted
+	for _, d := range diffs {
+		if m, found := b.match(t, d.Field, now); found {
+			ok = append(ok, accepted{Field: d.Field, Reason: m.reason})
+			continue
+		}
+		failed = append(failed, d)
+	}
+	return failed, ok
+}
+
+func (b *baseline) match(t test, field string, now time.Time) (baselineMatcher, bool) {
+	for _, m := range b.entries {
+		if !m.expired(now) && m.matches(t, field) {
+			return m, true
+		}
+	}
+	return baselineMatcher{}, false
+}
+
+// expired returns true when a difference only matches expired entries
+func (b *baseline) expired(t test, field string, now time.Time) bool {
+	for _, m := range b.entries {
+		if m.expired(now) && m.matches(t, field) {
+			return true
+		}
+	}
+	return false
+}
+
+// update adds an entry for the failed fields of every row, grouped by
+// fields. Existing entries are kept, and differences of expired entries
+// aren't added again, so they keep failing until the entry is renewed.
+func (b *baseline) update(tests map[int]test, fields map[int][]string, expires string) int {
+	now := time.Now()
+	groups := map[string]*baselineEntry{}
+	keys := []string{}
+	for row, fs := range fields {
+		t := tests[row]
+		add := []string{}
+		for _, f := range fs {
+			if f == "_error" || b.expired(t, f, now) {
+				continue
+			}
+			add = append(add, f)
+		}
+		if len(add) == 0 {
+			continue
+		}
+		sort.Strings(add)
+
+		key := strings.Join(add, "\n")
+		e, ok := groups[key]
+		if !ok {
+			e = &baselineEntry{Fields: add, Expires: expires}
+			groups[key] = e
+			keys = append(keys, key)
+		}
+		e.Rows = append(e.Rows, row)
+	}
+
+	for _, e := range groups {
+		sort.Ints(e.Rows)
+	}
+	// ordered by their first row
+	sort.Slice(keys, func(i, j int) bool {
+		return groups[keys[i]].Rows[0] < groups[keys[j]].Rows[0]
+	})
+	for _, k := range keys {
+		b.file.Accepted = append(b.file.Accepted, *groups[k])
+	}
+	return len(keys)
+}
+
+// write writes the baseline file
+func (b *baseline) write() error {
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(b.file); err != nil {
+		return err
+	}
+	if err := enc.Close(); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(b.path, buf.Bytes(), 0644)
+}
@@ -0,0 +1,144 @@
+package diff
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_baselineAccept(t *testing.T) {
+	dir, err := ioutil.TempDir("", "apicmp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "baseline.yaml")
+
+	// the unquoted date is decoded as a timestamp
+	err = ioutil.WriteFile(path, []byte(`accepted:
+  - route: GET /users/{id}
+    fields: [price]
+    reason: the old service rounds prices
+  - rows: [2, 3]
+    fields: ["_schema.*"]
+  - route: "* /orders*"
+    fields: [total]
+    expires: 2026-10-01
+`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := loadBaseline(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "2026-10-01", b.file.Accepted[2].Expires)
+
+	now := time.Date(2026, 10, 19, 12, 0, 0, 0, time.Local)
+	diffs := []diff{{Field: "_schema.name"}, {Field: "price"}, {Field: "total"}}
+	tests := []struct {
+		name         string
+		t            test
+		now          time.Time
+		wantFailed   []string
+		wantAccepted []accepted
+	}{
+		{
+			name:         "by route",
+			t:            test{Row: 1, Route: "GET /users/{id}"},
+			now:          now,
+			wantFailed:   []string{"_schema.name", "total"},
+			wantAccepted: []accepted{{Field: "price", Reason: "the old service rounds prices"}},
+		},
+		{
+			name:         "by row with a wildcard field",
+			t:            test{Row: 2, Route: "POST /users"},
+			now:          now,
+			wantFailed:   []string{"price", "total"},
+			wantAccepted: []accepted{{Field: "_schema.name"}},
+		},
+		{
+			name:       "expired",
+			t:          test{Row: 4, Route: "GET /orders/{id}"},
+			now:        now,
+			wantFailed: []string{"_schema.name", "price", "total"},
+		},
+		{
+			name:         "on the expiry date",
+			t:            test{Row: 4, Route: "GET /orders/{id}"},
+			now:          time.Date(2026, 10, 1, 23, 0, 0, 0, time.Local),
+			wantFailed:   []string{"_schema.name", "price"},
+			wantAccepted: []accepted{{Field: "total"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			failed, ok := b.accept(tt.t, diffs, tt.now)
+			fields := []string{}
+			for _, d := range failed {
+				fields = append(fields, d.Field)
+			}
+			assert.Equal(t, tt.wantFailed, fields)
+			assert.Equal(t, tt.wantAccepted, ok)
+		})
+	}
+}
+
+func Test_baselineUpdate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "apicmp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "baseline.yaml")
+
+	// a missing file is empty
+	b, err := loadBaseline(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Empty(t, b.file.Accepted)
+
+	err = ioutil.WriteFile(path, []byte("accepted:\n  - route: GET /orders/{id}\n    fields: [total]\n    expires: \"2020-01-01\"\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err = loadBaseline(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := map[int]test{
+		1: {Row: 1, Route: "GET /users/{id}"},
+		2: {Row: 2, Route: "GET /users/{id}"},
+		3: {Row: 3, Route: "GET /orders/{id}"},
+		4: {Row: 4},
+	}
+	n := b.update(tests, map[int][]string{
+		2: {"price", "name"},
+		1: {"name", "price"},
+		3: {"total", "id"},
+		4: {"_error"},
+	}, "2026-12-31")
+	assert.Equal(t, 2, n)
+	assert.Equal(t, []baselineEntry{
+		{Route: "GET /orders/{id}", Fields: []string{"total"}, Expires: "2020-01-01"},
+		{Rows: []int{1, 2}, Fields: []string{"name", "price"}, Expires: "2026-12-31"},
+		{Rows: []int{3}, Fields: []string{"id"}, Expires: "2026-12-31"},
+	}, b.file.Accepted)
+
+	assert.NoError(t, b.write())
+	got, err := loadBaseline(path)
+	assert.NoError(t, err)
+	assert.Equal(t, b.file, got.file)
+	assert.Len(t, got.entries, 3)
+
+	// fields are required
+	assert.NoError(t, ioutil.WriteFile(path, []byte("accepted:\n  - rows: [1]\n"), 0644))
+	_, err = loadBaseline(path)
+	assert.EqualError(t, err, "entry #1: fields are required")
+}
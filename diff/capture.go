@@ -0,0 +1,254 @@
+package diff
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// DefaultCaptureDenyHeaders are never captured unless CaptureSecrets is set
+var DefaultCaptureDenyHeaders = []string{
+	"Authorization",
+	"Cookie",
+	"Proxy-Authorization",
+	"X-Api-Key",
+	"X-Auth-Token",
+	"X-Csrf-Token",
+}
+
+// CaptureConfig configures the fixture file recorded by Capture
+type CaptureConfig struct {
+	Listen         string // i.e. :8080
+	TargetBasePath string
+	Target         TargetConfig
+	OutputFilePath string   // stdout when empty
+	Format         string   // csv or jsonl. Guessed from the output file extension when empty
+	AllowHeaders   []string // the captured headers. Every header of jsonl files when empty
+	DenyHeaders    []string // headers that are never captured, in addition to DefaultCaptureDenyHeaders
+	CaptureSecrets bool     // capture DefaultCaptureDenyHeaders too
+	SnapshotDir    string   // every response is recorded to this directory, see Serve
+	LogLevel       string
+}
+
+// capture returns the response of the target to every request, and writes
+// requests with a JSON response as fixture rows
+type capture struct {
+	t       *target
+	allow   []string
+	deny    map[string]struct{}
+	csv     bool
+	snaps   string // the snapshot directory
+	mu      sync.Mutex
+	w       fixtureWriter
+	seen    map[string]struct{}
+	rows    int
+	skipped int
+}
+
+// Capture is a pass-through reverse proxy in front of a target that records
+// the requests as a fixture file. Duplicate requests are written once. The
+// file is complete when the context is canceled.
+func Capture(ctx context.Context, c CaptureConfig) error {
+	if c.LogLevel != "" {
+		if err := setLoglevel(c.LogLevel); err != nil {
+			return err
+		}
+	}
+
+	var out io.Writer = os.Stdout
+	if c.OutputFilePath != "" && c.OutputFilePath != "-" {
+		f, err := os.Create(c.OutputFilePath)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		out = f
+
+		if c.Format == "" {
+			c.Format = fixtureFormat(Config{FixtureFilePath: c.OutputFilePath})
+		}
+	}
+
+	// the dialer of unix socket base paths is set like it is for diff
+	tc := Config{
+		BeforeBasePath: c.TargetBasePath,
+		Targets:        map[string]TargetConfig{"before": c.Target},
+	}.withUnixSockets()
+	cp, err := newCapture(tc, out, c)
+	if err != nil {
+		return err
+	}
+
+	srv := &http.Server{Addr: c.Listen, Handler: cp}
+	errs := make(chan error, 1)
+	go func() {
+		errs <- srv.ListenAndServe()
+	}()
+	log.Infof("capturing %s to %s", c.Listen, c.TargetBasePath)
+
+	select {
+	case err = <-errs:
+	case <-ctx.Done():
+		sctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		err = srv.Shutdown(sctx)
+		cancel()
+	}
+	if errors.Is(err, http.ErrServerClosed) {
+		err = nil
+	}
+
+	log.Infof("captured %d requests, skipped %d duplicates", cp.rows, cp.skipped)
+	if ferr := cp.w.Flush(); err == nil {
+		err = ferr
+	}
+	return err
+}
+
+// newCapture returns a capture of the before target of a config
+func newCapture(c Config, out io.Writer, cc CaptureConfig) (*capture, error) {
+	t, err := newTarget(c, "before", c.BeforeBasePath)
+	if err != nil {
+		return nil, err
+	}
+	if t.grpc != nil {
+		return nil, errors.New("capture: grpc targets aren't supported")
+	}
+	t.returnRedirects()
+
+	denied := cc.DenyHeaders
+	if !cc.CaptureSecrets {
+		denied = append(append([]string{}, DefaultCaptureDenyHeaders...), denied...)
+	}
+	deny := make(map[string]struct{}, len(denied))
+	for _, h := range denied {
+		deny[http.CanonicalHeaderKey(h)] = struct{}{}
+	}
+	allow := []string{}
+	for _, h := range cc.AllowHeaders {
+		if _, ok := deny[http.CanonicalHeaderKey(h)]; ok {
+			log.Warnf("capture: %s is denied, it won't be captured", h)
+			continue
+		}
+		allow = append(allow, h)
+	}
+
+	if cc.SnapshotDir != "" {
+		if err := os.MkdirAll(cc.SnapshotDir, 0755); err != nil {
+			return nil, err
+		}
+	}
+
+	format := cc.Format
+	if format == "" {
+		format = FormatCSV
+	}
+	w, err := newFixtureWriter(out, format, allow)
+	if err != nil {
+		return nil, err
+	}
+
+	return &capture{
+		t:     t,
+		allow: allow,
+		deny:  deny,
+		csv:   format == FormatCSV,
+		snaps: cc.SnapshotDir,
+		w:     w,
+		seen:  map[string]struct{}{},
+	}, nil
+}
+
+// ServeHTTP sends a request to the target and returns its response. The
+// request is written as a row when the response is JSON, and every response
+// is recorded as a snapshot.
+func (cp *capture) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	f := Fixture{
+		Method:  r.Method,
+		Path:    r.URL.RequestURI(),
+		Headers: proxyHeaders(r),
+		Body:    string(body),
+	}
+	i := input{
+		Method:  f.Method,
+		Path:    cp.t.base + f.Path,
+		Headers: f.Headers,
+		Body:    f.Body,
+	}
+	resp, raw, err := pass(w, r, cp.t, i)
+	if err != nil {
+		log.Errorf("%s %s err:%v", f.Method, f.Path, err)
+		return
+	}
+	if cp.snaps != "" {
+		if err := newSnapshot(r, body, resp, raw).write(cp.snaps); err != nil {
+			log.Errorf("snapshot: %v", err)
+		}
+	}
+	if ct := resp.Header.Get("Content-Type"); !strings.Contains(ct, "json") {
+		log.Debugf("capture: skipping %s %s with %s response", f.Method, f.Path, ct)
+		return
+	}
+
+	f.Headers = cp.headers(r.Header)
+	if err := cp.write(f); err != nil {
+		log.Errorf("capture: %v", err)
+	}
+}
+
+// headers returns the allowed headers of a request
+func (cp *capture) headers(h http.Header) map[string]string {
+	out := map[string]string{}
+	if len(cp.allow) > 0 || cp.csv {
+		for _, k := range cp.allow {
+			if vs := h.Values(k); len(vs) > 0 {
+				out[k] = strings.Join(vs, ", ")
+			}
+		}
+		return out
+	}
+
+	for k, vs := range h {
+		if _, ok := cp.deny[k]; ok {
+			continue
+		}
+		if _, ok := harSkipHeaders[strings.ToLower(k)]; ok || isHopHeader(k) {
+			continue
+		}
+		out[k] = strings.Join(vs, ", ")
+	}
+	return out
+}
+
+// write writes a row unless the request was already captured. Rows are
+// flushed as they're written, so a killed capture keeps its rows.
+func (cp *capture) write(f Fixture) error {
+	cp.mu.Lock()
+	defer cp.mu.Unlock()
+
+	key := fixtureKey(f)
+	if _, ok := cp.seen[key]; ok {
+		cp.skipped++
+		return nil
+	}
+	cp.seen[key] = struct{}{}
+
+	cp.rows++
+	if err := cp.w.Write(f); err != nil {
+		return err
+	}
+	return cp.w.Flush()
+}
@@ -0,0 +1,153 @@
+package diff
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_capture(t *testing.T) {
+	api := newProxiedServer("john")
+	defer api.Close()
+
+	tests := []struct {
+		name    string
+		format  string
+		allow   []string
+		deny    []string
+		secrets bool
+		want    string
+	}{
+		{
+			name:   "csv has a column per allowed header",
+			format: FormatCSV,
+			allow:  []string{"X-Tenant", "Authorization"},
+			want: "method,path,body,X-Tenant\n" +
+				"GET,/users/1?fields=name,,acme\n" +
+				"POST,/users,\"{\"\"name\"\":\"\"joe\"\"}\",acme\n",
+		},
+		{
+			name:   "jsonl has every header that isn't denied",
+			format: FormatJSONL,
+			want: `{"method":"GET","path":"/users/1?fields=name","headers":{"User-Agent":"apicmp","X-Tenant":"acme"}}` + "\n" +
+				`{"method":"POST","path":"/users","headers":{"Content-Type":"application/json","User-Agent":"apicmp","X-Tenant":"acme"},"body":"{\"name\":\"joe\"}"}` + "\n",
+		},
+		{
+			name:   "denied headers are added to the defaults",
+			format: FormatJSONL,
+			deny:   []string{"x-tenant", "Content-Type"},
+			want: `{"method":"GET","path":"/users/1?fields=name","headers":{"User-Agent":"apicmp"}}` + "\n" +
+				`{"method":"POST","path":"/users","headers":{"User-Agent":"apicmp"},"body":"{\"name\":\"joe\"}"}` + "\n",
+		},
+		{
+			name:    "secrets are captured on request",
+			format:  FormatCSV,
+			allow:   []string{"Authorization"},
+			secrets: true,
+			want: "method,path,body,Authorization\n" +
+				"GET,/users/1?fields=name,,Bearer secret\n" +
+				"POST,/users,\"{\"\"name\"\":\"\"joe\"\"}\",Bearer secret\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out := &bytes.Buffer{}
+			cp, err := newCapture(Config{BeforeBasePath: api.URL}, out, CaptureConfig{
+				Format:         tt.format,
+				AllowHeaders:   tt.allow,
+				DenyHeaders:    tt.deny,
+				CaptureSecrets: tt.secrets,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			srv := httptest.NewServer(cp)
+			defer srv.Close()
+
+			send := func(method, path, body string) string {
+				req, err := http.NewRequest(method, srv.URL+path, strings.NewReader(body))
+				if err != nil {
+					t.Fatal(err)
+				}
+				req.Header.Set("User-Agent", "apicmp")
+				req.Header.Set("X-Tenant", "acme")
+				req.Header.Set("Authorization", "Bearer secret")
+				if body != "" {
+					req.Header.Set("Content-Type", "application/json")
+				}
+				resp, err := srv.Client().Do(req)
+				if err != nil {
+					t.Fatal(err)
+				}
+				defer resp.Body.Close()
+				raw, _ := ioutil.ReadAll(resp.Body)
+				return string(raw)
+			}
+
+			assert.Equal(t, `{"id":1,"name":"john"}`+"\n", send(http.MethodGet, "/users/1?fields=name", ""))
+			send(http.MethodGet, "/users/1?fields=name", "") // duplicate
+			send(http.MethodGet, "/", "")                    // html
+			assert.Equal(t, `{"name":"joe"}`, send(http.MethodPost, "/users", `{"name":"joe"}`))
+
+			assert.Equal(t, tt.want, out.String())
+			assert.Equal(t, 2, cp.rows)
+			assert.Equal(t, 1, cp.skipped)
+		})
+	}
+}
+
+func Test_captureFixtureIsRead(t *testing.T) {
+	dir, err := ioutil.TempDir("", "apicmp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "captured.csv")
+
+	api := newProxiedServer("john")
+	defer api.Close()
+
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cp, err := newCapture(Config{BeforeBasePath: api.URL}, f, CaptureConfig{AllowHeaders: []string{"X-Tenant"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(cp)
+	req, _ := http.NewRequest(http.MethodGet, srv.URL+"/users/1", nil)
+	req.Header.Set("X-Tenant", "acme")
+	resp, err := srv.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	srv.Close()
+	f.Close()
+
+	testChan, err := generateTests(context.Background(), Config{
+		BeforeBasePath:  "http://before.api.com",
+		AfterBasePath:   "http://after.api.com",
+		FixtureFilePath: path,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []test{}
+	for t := range testChan {
+		tests = append(tests, t)
+	}
+	if assert.Len(t, tests, 1) {
+		assert.Equal(t, "http://before.api.com/users/1", tests[0].Before.Path)
+		assert.Equal(t, "acme", tests[0].Before.Headers["X-Tenant"])
+	}
+}
@@ -8,6 +8,7 @@ import (
 	"regexp"
 	"sort"
 	"strconv"
+	"strings"
 	"sync"
 	"time"
 
@@ -18,19 +19,26 @@ import (
 )
 
 type Summary struct {
-	Count         int
-	Passed        int
-	Failed        int
-	FailedRows    []int
-	FailedRowsStr string
-	Time          time.Duration
-	Issues        map[string][]int
+	Count           int
+	Passed          int
+	Failed          int
+	FailedRows      []int
+	FailedRowsStr   string
+	ErroredRows     []int
+	ErroredRowsStr  string
+	AcceptedRows    []int // rows that passed because their differences are accepted by the baseline
+	AcceptedRowsStr string
+	FailedStepsStr  string // scenario#step of the failed and errored rows of scenario files
+	Time            time.Duration
+	Issues          map[string][]int
 }
 
 type Config struct {
 	BeforeBasePath     string
 	AfterBasePath      string
+	CandidateBasePaths []string // additional targets compared by majority vote
 	FixtureFilePath    string
+	FixtureFormat      string // csv, jsonl, har, scenario, grpc or graphql. Guessed from the file extension when empty
 	Headers            []string
 	QueryStrings       []string
 	IgnoreQueryStrings *regexp.Regexp // regex to remove matched query strings
@@ -41,16 +49,83 @@ type Config struct {
 	LogLevel           string
 	Threads            int
 	PostmanFilePath    string
+	PostmanEnvFilePath string // resolves {{variables}} of --format postman
 	Jq                 string
+	StateFilePath      string                  // completed rows are appended to this file
+	Resume             bool                    // skip rows that were completed in StateFilePath
+	FailuresFilePath   string                  // failed and errored rows are written to this fixture file
+	OpenAPIFilePath    string                  // responses are validated against this OpenAPI 3 spec
+	Targets            map[string]TargetConfig // by target name, i.e. before
+	Sample             int                     // the maximum number of rows, spread evenly across routes
+	SamplePerRoute     int                     // the maximum number of rows per route
+	Seed               int64                   // seed of the sample. Random when 0
+	Dedupe             bool                    // drop duplicate rows. Implied by sampling
+	ProtoSetFiles      []string                // descriptor sets of gRPC targets. Server reflection is used otherwise
+	Paginate           *Paginate               // follow the pages of every row, unless a row has its own
+	Templates          bool                    // evaluate the template expressions of fixture cells
+	HistoryFilePath    string                  // the run and the outcome of every row are added to this file
+	BaselineFilePath   string                  // differences listed in this file are accepted
+	BaselineUpdate     bool                    // add the differences of this run to the baseline file
+	BaselineExpires    string                  // the expiry of the entries added by BaselineUpdate, YYYY-MM-DD
+
+	completed map[int]struct{}
+}
+
+func (s *Summary) add(rs rowState) {
+	s.Count++
+	if len(rs.Fields) == 0 {
+		s.Passed++
+		if len(rs.Accepted) > 0 {
+			s.AcceptedRows = append(s.AcceptedRows, rs.Row)
+		}
+		return
+	}
+
+	s.FailedRows = append(s.FailedRows, rs.Row)
+	for _, f := range rs.Fields {
+		s.Issues[f] = append(s.Issues[f], rs.Row)
+	}
 }
 
 // Cmp will compare the before and after
 func Cmp(ctx context.Context, c Config) error {
 	start := time.Now()
 
-	if err := setLoglevel(c.LogLevel); err != nil {
+	err := setLoglevel(c.LogLevel)
+	if err != nil {
 		return err
 	}
+	c = c.withUnixSockets()
+
+	// load the rows completed by a previous run
+	var prev map[int]rowState
+	run := newStateRun(c)
+	if c.Resume {
+		var prevRun *stateRun
+		prevRun, prev, err = loadState(c.StateFilePath)
+		if err != nil {
+			return fmt.Errorf("state file: %w", err)
+		}
+		if prevRun != nil || len(prev) > 0 {
+			if err := prevRun.match(run); err != nil {
+				return fmt.Errorf("state file %s: %w", c.StateFilePath, err)
+			}
+		}
+		c.completed = make(map[int]struct{}, len(prev))
+		for row := range prev {
+			c.completed[row] = struct{}{}
+		}
+		log.Infof("resuming, skipping %d completed rows", len(prev))
+	}
+
+	var state *stateWriter
+	if c.StateFilePath != "" {
+		state, err = newStateWriter(c.StateFilePath, c.Resume, run)
+		if err != nil {
+			return fmt.Errorf("state file: %w", err)
+		}
+		defer state.Close()
+	}
 
 	// gen tests
 	tChan, err := generateTests(ctx, c)
@@ -67,18 +142,38 @@ func Cmp(ctx context.Context, c Config) error {
 		}
 	}
 
+	// load the contract
+	var validator *openAPIValidator
+	if c.OpenAPIFilePath != "" {
+		spec, err := loadOpenAPI(c.OpenAPIFilePath)
+		if err != nil {
+			return err
+		}
+		validator = newOpenAPIValidator(spec)
+	}
+
+	// load the accepted differences
+	var b *baseline
+	if c.BaselineFilePath != "" {
+		b, err = loadBaseline(c.BaselineFilePath)
+		if err != nil {
+			return fmt.Errorf("baseline file: %w", err)
+		}
+	}
+
 	// init assertion workers
-	client := newRetriableHTTPClient(c.Retry)
-	var wantMatch jsondiff.Difference
-	switch c.Match {
-	case "superset":
-		wantMatch = jsondiff.SupersetMatch
-	default:
-		wantMatch = jsondiff.FullMatch
+	targets, err := newTargets(c)
+	if err != nil {
+		return err
+	}
+	defer closeTargets(targets)
+	wantMatch, err := parseMatch(c.Match)
+	if err != nil {
+		return err
 	}
 	cs := make([]<-chan result, c.Threads)
 	for i := 0; i < c.Threads; i++ {
-		cs[i] = compare(ctx, client, tChan, c.IgnoreFields, wantMatch, jq)
+		cs[i] = compare(ctx, targets, tChan, c.IgnoreFields, wantMatch, jq, validator, b)
 	}
 
 	collection := make([]test, 0)
@@ -88,27 +183,53 @@ func Cmp(ctx context.Context, c Config) error {
 		Issues: map[string][]int{},
 	}
 	results := merge(cs...)
+	failures := map[int][]string{}
+	steps := map[int]string{}
+	rows := []rowState{}
 	for r := range results {
-		sum.Count++
+		if r.e.Name != "" {
+			steps[r.e.Row] = r.e.Name
+		}
+		if r.err != nil {
+			sum.ErroredRows = append(sum.ErroredRows, r.e.Row)
+			failures[r.e.Row] = []string{"_error"}
+			continue
+		}
+
+		rs := newRowState(r)
+		sum.add(rs)
+		rows = append(rows, rs)
+		if state != nil {
+			if err := state.Write(rs); err != nil {
+				log.Errorf("state file: %v", err)
+			}
+		}
 
 		if len(r.Diffs) > 0 {
+			failures[rs.Row] = rs.Fields
 			collection = append(collection, r.e)
-			_ = tpl.ExecuteTemplate(os.Stdout, "curl", r.e)
-			sum.FailedRows = append(sum.FailedRows, r.e.Row)
-
-			fmt.Println("Diff:")
-			for _, v := range r.Diffs {
-				sum.Issues[v.Field] = append(sum.Issues[v.Field], r.e.Row)
-				fmt.Println(v.Field + ":")
-				if log.IsLevelEnabled(log.DebugLevel) {
-					fmt.Println(v.Delta)
-				} else {
-					fmt.Println("Error: Not Equal")
-				}
+			printResult(r)
+		}
+	}
+
+	// merge the results of the previous run
+	for _, rs := range prev {
+		if len(c.Rows) > 0 {
+			if _, ok := c.Rows[rs.Row]; !ok {
+				continue
 			}
-			fmt.Printf("\n\n")
-		} else {
-			sum.Passed++
+		}
+		sum.add(rs)
+		rows = append(rows, rs)
+		if !rs.Passed {
+			failures[rs.Row] = rs.Fields
+		}
+	}
+
+	if c.FailuresFilePath != "" {
+		err = writeFailures(c, failures)
+		if err != nil {
+			return fmt.Errorf("failures file: %w", err)
 		}
 	}
 
@@ -120,16 +241,160 @@ func Cmp(ctx context.Context, c Config) error {
 		}
 	}
 
+	sum.Time = time.Since(start)
+	printSummary(sum, steps)
+
+	// after the summary, so it isn't lost when a file can't be written
+	if c.BaselineUpdate && b != nil {
+		tests := make(map[int]test, len(failures))
+		for row := range failures {
+			// rows of a previous run are only known by their number
+			tests[row] = test{Row: row}
+		}
+		for _, t := range collection {
+			tests[t.Row] = t
+		}
+		n := b.update(tests, failures, c.BaselineExpires)
+		if err := b.write(); err != nil {
+			return fmt.Errorf("baseline file: %w", err)
+		}
+		log.Infof("added %d entries to %s", n, c.BaselineFilePath)
+	}
+
+	if c.HistoryFilePath != "" {
+		sort.Slice(rows, func(i, j int) bool {
+			return rows[i].Row < rows[j].Row
+		})
+		errored := append([]int{}, sum.ErroredRows...)
+		sort.Ints(errored)
+		id, err := saveRun(c.HistoryFilePath, runRecord{
+			Start:   start,
+			End:     start.Add(sum.Time),
+			Config:  newRunConfig(c),
+			Rows:    rows,
+			Errored: errored,
+		})
+		if err != nil {
+			return fmt.Errorf("history file: %w", err)
+		}
+		log.Infof("saved run %d to %s", id, c.HistoryFilePath)
+	}
+
+	return nil
+}
+
+func compare(ctx context.Context, targets []*target, tests <-chan test,
+	ignore map[string]struct{}, wantMatch jsondiff.Difference, jq *gojq.Query, validator *openAPIValidator,
+	b *baseline) <-chan result {
+	results := make(chan result)
+
+	// check compares a single test, it returns false when the test was canceled
+	check := func(t test) (result, bool) {
+		ign, wm, q, err := t.Options.apply(ignore, wantMatch, jq)
+		if t.err != nil {
+			err = t.err
+		}
+		if err != nil {
+			_ = tpl.ExecuteTemplate(os.Stdout, "curl", t)
+			log.Errorf("row:%d err:%v", t.Row, err)
+			return result{e: t, err: err}, true
+		}
+
+		r, err := exec(ctx, targets, t, ign, wm, q)
+		if errors.Is(err, context.Canceled) {
+			log.Infof("row:%d was canceled", t.Row)
+			return r, false
+		}
+		if validator != nil {
+			r.Diffs = append(r.Diffs, validator.validateResult(r)...)
+			sort.Slice(r.Diffs, func(i, j int) bool {
+				return r.Diffs[i].Field < r.Diffs[j].Field
+			})
+			// a response that can't be decoded, i.e. an HTML error page, is
+			// reported by its contract violations instead of the decoding error
+			if isDecodeError(err) && violatesUndecoded(r) {
+				log.Warnf("row:%d err:%v", t.Row, err)
+				err = nil
+			}
+		}
+		if err != nil {
+			_ = tpl.ExecuteTemplate(os.Stdout, "curl", r.e)
+			log.Errorf("row:%d err:%v", t.Row, err)
+			r.err = err
+		}
+		if r.err == nil && b != nil {
+			r.Diffs, r.Accepted = b.accept(r.e, r.Diffs, time.Now())
+			if len(r.Diffs) == 0 && len(r.Accepted) > 0 {
+				log.Debugf("row:%d differences are accepted by the baseline", r.e.Row)
+			}
+		}
+		return r, true
+	}
+
+	go func() {
+		for t := range tests {
+			if t.Scenario != nil {
+				t.Scenario.run(check, results)
+				continue
+			}
+
+			if r, ok := check(t); ok {
+				results <- r
+			}
+		}
+
+		close(results)
+	}()
+
+	return results
+}
+
+// printResult prints the requests and the diffs of a failed result
+func printResult(r result) {
+	_ = tpl.ExecuteTemplate(os.Stdout, "curl", r.e)
+	_ = tpl.ExecuteTemplate(os.Stdout, "protocol", r)
+	if len(r.Diverge) > 0 {
+		_ = tpl.ExecuteTemplate(os.Stdout, "vote", r)
+	}
+
+	fmt.Println("Diff:")
+	for _, v := range r.Diffs {
+		fmt.Println(v.Field + ":")
+		if log.IsLevelEnabled(log.DebugLevel) {
+			fmt.Println(v.Delta)
+		} else {
+			fmt.Println("Error: Not Equal")
+		}
+	}
+	if len(r.Accepted) > 0 {
+		fmt.Println("Accepted:")
+		for _, a := range r.Accepted {
+			if a.Reason == "" {
+				fmt.Println(a.Field)
+				continue
+			}
+			fmt.Println(a.Field + ": " + a.Reason)
+		}
+	}
+	fmt.Printf("\n\n")
+}
+
+// printSummary prints the summary and the table of issues by field
+func printSummary(sum Summary, steps map[int]string) {
 	sumTable := [][]string{}
 	for k, v := range sum.Issues {
 		sumTable = append(sumTable, []string{k, strconv.Itoa(len(v)), Istoa(v, ",")})
 	}
 	sort.Sort(sortDelta(sumTable))
 	sort.Ints(sum.FailedRows)
+	sort.Ints(sum.ErroredRows)
+	sort.Ints(sum.AcceptedRows)
 
 	sum.Failed = sum.Count - sum.Passed
 	sum.FailedRowsStr = Istoa(sum.FailedRows, ",")
-	sum.Time = time.Since(start)
+	sum.ErroredRowsStr = Istoa(sum.ErroredRows, ",")
+	sum.AcceptedRowsStr = Istoa(sum.AcceptedRows, ",")
+	sum.FailedStepsStr = failedSteps(steps, sum.FailedRows, sum.ErroredRows)
 
 	_ = tpl.ExecuteTemplate(os.Stdout, "summary", sum)
 	table := tablewriter.NewWriter(os.Stdout)
@@ -138,34 +403,19 @@ func Cmp(ctx context.Context, c Config) error {
 	table.SetBorder(false)
 	table.AppendBulk(sumTable)
 	table.Render()
-
-	return nil
 }
 
-func compare(ctx context.Context, client httpClient, tests <-chan test,
-	ignore map[string]struct{}, wantMatch jsondiff.Difference, jq *gojq.Query) <-chan result {
-	results := make(chan result)
-
-	go func() {
-		for t := range tests {
-			r, err := exec(ctx, client, t, ignore, wantMatch, jq)
-			if err != nil {
-				if errors.Is(err, context.Canceled) {
-					log.Infof("row:%d was canceled", t.Row)
-				} else {
-					_ = tpl.ExecuteTemplate(os.Stdout, "curl", r.e)
-					log.Errorf("row:%d err:%v", t.Row, err)
-				}
-
-				continue
+// failedSteps returns the scenario#step names of failed and errored rows
+func failedSteps(steps map[int]string, rows ...[]int) string {
+	names := []string{}
+	for _, rs := range rows {
+		for _, row := range rs {
+			if name, ok := steps[row]; ok {
+				names = append(names, name)
 			}
-			results <- r
 		}
-
-		close(results)
-	}()
-
-	return results
+	}
+	return strings.Join(names, ",")
 }
 
 func merge(cs ...<-chan result) <-chan result {
@@ -0,0 +1,157 @@
+package diff
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// The columns added to a failures file. They are ignored when the file is
+// fed back with --file, so the original row is retained across reruns.
+const (
+	originalRowColumn  = "original_row"
+	failedFieldsColumn = "failed_fields"
+)
+
+// writeFailures writes the failed rows of the fixture file to a new fixture
+// file. failures maps the row number to its failing fields.
+// CSV files are copied row by row, every other format is written as JSON Lines.
+func writeFailures(c Config, failures map[int][]string) error {
+	if fixtureFormat(c) == FormatCSV {
+		return writeCSVFailures(c.FixtureFilePath, c.FailuresFilePath, failures)
+	}
+
+	r, err := newFixtureReader(c)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	out, err := os.Create(c.FailuresFilePath)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	w := bufio.NewWriter(out)
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+
+	// rows are numbered exactly like generateTests does
+	cursor := 0
+	for {
+		cursor++
+
+		f, err := r.Read()
+		if err != nil {
+			if err == io.EOF {
+				break
+			}
+			continue
+		}
+
+		failed, ok := failures[cursor]
+		if !ok {
+			continue
+		}
+
+		j, err := f.jsonl()
+		if err != nil {
+			return err
+		}
+		if j.OriginalRow == 0 {
+			j.OriginalRow = cursor
+		}
+		j.FailedFields = failed
+
+		if err := enc.Encode(j); err != nil {
+			return err
+		}
+	}
+
+	return w.Flush()
+}
+
+// writeCSVFailures copies the header and the failed rows of a CSV file
+func writeCSVFailures(fixturePath, outPath string, failures map[int][]string) error {
+	in, err := os.Open(fixturePath)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	reader := csv.NewReader(in)
+	reader.LazyQuotes = true
+	reader.FieldsPerRecord = -1
+
+	header, err := reader.Read()
+	if err != nil {
+		return err
+	}
+
+	rowIdx, fieldsIdx := unset, unset
+	for k, v := range header {
+		switch strings.Replace(v, "\ufeff", "", -1) {
+		case originalRowColumn:
+			rowIdx = k
+		case failedFieldsColumn:
+			fieldsIdx = k
+		}
+	}
+	if rowIdx == unset {
+		header = append(header, originalRowColumn)
+		rowIdx = len(header) - 1
+	}
+	if fieldsIdx == unset {
+		header = append(header, failedFieldsColumn)
+		fieldsIdx = len(header) - 1
+	}
+
+	out, err := os.Create(outPath)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	w := csv.NewWriter(out)
+	if err := w.Write(header); err != nil {
+		return err
+	}
+
+	// rows are numbered exactly like generateTests does
+	cursor := 0
+	for {
+		cursor++
+
+		fields, err := reader.Read()
+		if err != nil {
+			if err == io.EOF {
+				break
+			}
+			continue
+		}
+
+		failed, ok := failures[cursor]
+		if !ok {
+			continue
+		}
+
+		row := make([]string, len(header))
+		copy(row, fields)
+		if row[rowIdx] == "" {
+			row[rowIdx] = strconv.Itoa(cursor)
+		}
+		row[fieldsIdx] = strings.Join(failed, ",")
+
+		if err := w.Write(row); err != nil {
+			return err
+		}
+	}
+
+	w.Flush()
+	return w.Error()
+}
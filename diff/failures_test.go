@@ -0,0 +1,72 @@
+package diff
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_writeFailures(t *testing.T) {
+	dir, err := ioutil.TempDir("", "apicmp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	first := filepath.Join(dir, "failed.csv")
+	err = writeCSVFailures("./testdata/get.csv", first, map[int][]string{
+		2: {"_http.StatusCode", "name"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := ioutil.ReadFile(first)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "path,X-Forwarded-For,X-Api-Key,original_row,failed_fields\n"+
+		"/users/2,192.168.1.2,abcd,2,\"_http.StatusCode,name\"\n", string(got))
+
+	// rerunning a failures file retains the original row
+	second := filepath.Join(dir, "failed_again.csv")
+	err = writeCSVFailures(first, second, map[int][]string{
+		1: {"_error"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err = ioutil.ReadFile(second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "path,X-Forwarded-For,X-Api-Key,original_row,failed_fields\n"+
+		"/users/2,192.168.1.2,abcd,2,_error\n", string(got))
+
+	// the failures file can be used as a fixture file
+	testChan, err := generateTests(context.Background(), Config{
+		BeforeBasePath:  "http://before.api.com",
+		AfterBasePath:   "http://after.api.com",
+		FixtureFilePath: first,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []test{}
+	for t := range testChan {
+		tests = append(tests, t)
+	}
+	if assert.Len(t, tests, 1) {
+		assert.Equal(t, map[string]string{
+			"X-Api-Key":       "abcd",
+			"X-Forwarded-For": "192.168.1.2",
+			"Content-Type":    "application/json",
+		}, tests[0].Before.Headers)
+	}
+}
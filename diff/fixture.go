@@ -0,0 +1,326 @@
+package diff
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/arithran/jsondiff"
+	"github.com/itchyny/gojq"
+)
+
+// Fixture formats supported by --format
+const (
+	FormatCSV      = "csv"
+	FormatJSONL    = "jsonl"
+	FormatHAR      = "har"
+	FormatPostman  = "postman"
+	FormatScenario = "scenario"
+)
+
+var (
+	errInvalidRow = errors.New("invalid row")
+	errSkipRow    = errors.New("skip row") // the row is counted, but not tested
+)
+
+type (
+	// Fixture is a single request read from a fixture file
+	Fixture struct {
+		Method      string
+		Path        string
+		Headers     map[string]string
+		Body        string
+		Options     Options
+		Stream      *Stream   // collect the events of a stream instead of a response
+		Paginate    *Paginate // follow the pages of a list, overrides --paginate
+		OriginalRow int       // the row of the fixture file that --write-failures copied this from
+	}
+	// Options overrides the comparison options of a single row
+	Options struct {
+		Ignore []string `json:"ignore,omitempty"`
+		Jq     string   `json:"jq,omitempty"`
+		Match  string   `json:"match,omitempty"`
+	}
+)
+
+// apply returns the comparison options with the overrides of the row applied.
+// Ignored fields are added to the ignored fields of --ignore.
+func (o Options) apply(ignore map[string]struct{}, wantMatch jsondiff.Difference,
+	jq *gojq.Query) (map[string]struct{}, jsondiff.Difference, *gojq.Query, error) {
+	if len(o.Ignore) > 0 {
+		merged := make(map[string]struct{}, len(ignore)+len(o.Ignore))
+		for k := range ignore {
+			merged[k] = struct{}{}
+		}
+		for _, k := range o.Ignore {
+			merged[k] = struct{}{}
+		}
+		ignore = merged
+	}
+
+	if o.Match != "" {
+		var err error
+		wantMatch, err = parseMatch(o.Match)
+		if err != nil {
+			return nil, 0, nil, err
+		}
+	}
+
+	if o.Jq != "" {
+		var err error
+		jq, err = gojq.Parse(o.Jq)
+		if err != nil {
+			return nil, 0, nil, err
+		}
+	}
+
+	return ignore, wantMatch, jq, nil
+}
+
+// jsonlFixture is the JSON Lines representation of a Fixture.
+// Headers may be a string or a list of strings and the body may be a string,
+// any other JSON value or base64 encoded binary data.
+type jsonlFixture struct {
+	Method       string                     `json:"method,omitempty"`
+	Path         string                     `json:"path"`
+	Headers      map[string]json.RawMessage `json:"headers,omitempty"`
+	Body         json.RawMessage            `json:"body,omitempty"`
+	BodyBase64   string                     `json:"body_base64,omitempty"`
+	Options      *Options                   `json:"options,omitempty"`
+	Stream       *Stream                    `json:"stream,omitempty"`
+	Paginate     *Paginate                  `json:"paginate,omitempty"`
+	OriginalRow  int                        `json:"original_row,omitempty"`
+	FailedFields []string                   `json:"failed_fields,omitempty"`
+}
+
+func (f *Fixture) UnmarshalJSON(data []byte) error {
+	var j jsonlFixture
+	if err := json.Unmarshal(data, &j); err != nil {
+		return err
+	}
+
+	*f = Fixture{
+		Method:      j.Method,
+		Path:        j.Path,
+		Headers:     map[string]string{},
+		Stream:      j.Stream,
+		Paginate:    j.Paginate,
+		OriginalRow: j.OriginalRow,
+	}
+	if f.Method == "" {
+		f.Method = "GET"
+	}
+	if j.Options != nil {
+		f.Options = *j.Options
+	}
+
+	for k, raw := range j.Headers {
+		var v string
+		if err := json.Unmarshal(raw, &v); err == nil {
+			f.Headers[k] = v
+			continue
+		}
+
+		// multiple values are combined as per RFC 7230 section 3.2.2
+		var vs []string
+		if err := json.Unmarshal(raw, &vs); err != nil {
+			return fmt.Errorf("header %s: %w", k, err)
+		}
+		f.Headers[k] = strings.Join(vs, ", ")
+	}
+
+	switch {
+	case j.BodyBase64 != "":
+		body, err := base64.StdEncoding.DecodeString(j.BodyBase64)
+		if err != nil {
+			return fmt.Errorf("body_base64: %w", err)
+		}
+		f.Body = string(body)
+	case len(j.Body) > 0 && j.Body[0] == '"':
+		if err := json.Unmarshal(j.Body, &f.Body); err != nil {
+			return err
+		}
+	case len(j.Body) > 0 && !bytes.Equal(j.Body, []byte("null")):
+		// the body is a JSON object, array or literal
+		f.Body = string(j.Body)
+	}
+
+	return nil
+}
+
+func (f Fixture) MarshalJSON() ([]byte, error) {
+	j, err := f.jsonl()
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(j)
+}
+
+func (f Fixture) jsonl() (jsonlFixture, error) {
+	j := jsonlFixture{
+		Method:      f.Method,
+		Path:        f.Path,
+		Headers:     make(map[string]json.RawMessage, len(f.Headers)),
+		Stream:      f.Stream,
+		Paginate:    f.Paginate,
+		OriginalRow: f.OriginalRow,
+	}
+	if f.Options.Jq != "" || f.Options.Match != "" || len(f.Options.Ignore) > 0 {
+		j.Options = &f.Options
+	}
+
+	for k, v := range f.Headers {
+		raw, err := json.Marshal(v)
+		if err != nil {
+			return j, err
+		}
+		j.Headers[k] = raw
+	}
+
+	if utf8.ValidString(f.Body) {
+		if f.Body != "" {
+			raw, err := json.Marshal(f.Body)
+			if err != nil {
+				return j, err
+			}
+			j.Body = raw
+		}
+	} else {
+		j.BodyBase64 = base64.StdEncoding.EncodeToString([]byte(f.Body))
+	}
+
+	return j, nil
+}
+
+// setDefaultHeaders adds the headers that csvHelper always sends, unless
+// the fixture already has them
+func setDefaultHeaders(hs map[string]string) {
+	for k := range hs {
+		if strings.EqualFold(k, "Content-Type") {
+			return
+		}
+	}
+	hs["Content-Type"] = "application/json"
+}
+
+type fixtureReader interface {
+	// Read returns the next fixture or io.EOF when there are no more fixtures.
+	// Every call to Read is a row, including the ones that return an error.
+	Read() (Fixture, error)
+	Close() error
+}
+
+func newFixtureReader(c Config) (fixtureReader, error) {
+	switch fixtureFormat(c) {
+	case FormatJSONL:
+		return newJSONLReader(c.FixtureFilePath)
+	case FormatHAR:
+		return newHARReader(c.FixtureFilePath)
+	case FormatPostman:
+		return newPostmanReader(c.FixtureFilePath, c.PostmanEnvFilePath)
+	case FormatCSV:
+		return newCSVReader(c.FixtureFilePath)
+	case FormatGRPC:
+		return newGRPCReader(c.FixtureFilePath)
+	case FormatGraphQL:
+		return newGraphQLReader(c.FixtureFilePath)
+	case FormatScenario:
+		return nil, errors.New("scenario files can't be read row by row")
+	default:
+		return nil, fmt.Errorf("unsupported fixture format %q", c.FixtureFormat)
+	}
+}
+
+// FixtureFormat returns the format of a fixture file, or guesses it from the
+// file extension when it's empty
+func FixtureFormat(path, format string) string {
+	return fixtureFormat(Config{FixtureFilePath: path, FixtureFormat: format})
+}
+
+// fixtureFormat returns --format or guesses the format from the file extension
+func fixtureFormat(c Config) string {
+	if c.FixtureFormat != "" {
+		return c.FixtureFormat
+	}
+
+	switch strings.ToLower(filepath.Ext(c.FixtureFilePath)) {
+	case ".jsonl", ".ndjson":
+		return FormatJSONL
+	case ".har":
+		return FormatHAR
+	case ".yaml", ".yml":
+		return FormatScenario
+	default:
+		return FormatCSV
+	}
+}
+
+type jsonlReader struct {
+	f       *os.File
+	scanner *bufio.Scanner
+	failed  bool // the error of the scanner was returned
+}
+
+func newJSONLReader(path string) (*jsonlReader, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 10*1024*1024)
+	return &jsonlReader{
+		f:       f,
+		scanner: scanner,
+	}, nil
+}
+
+// Read skips blank lines, so they're not counted as rows
+func (r *jsonlReader) Read() (Fixture, error) {
+	for r.scan() {
+		line := bytes.TrimSpace(r.scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+
+		var f Fixture
+		if err := json.Unmarshal(line, &f); err != nil {
+			return Fixture{}, err
+		}
+		if f.Path == "" {
+			return Fixture{}, errInvalidRow
+		}
+		setDefaultHeaders(f.Headers)
+		return f, nil
+	}
+
+	return Fixture{}, r.scanErr()
+}
+
+// scan advances to the next line. A scanner can't continue after an error,
+// the next call would return the truncated line, so it stops there.
+func (r *jsonlReader) scan() bool {
+	return r.scanner.Err() == nil && r.scanner.Scan()
+}
+
+// scanErr returns the error of the scanner once, i.e. bufio.ErrTooLong, and
+// io.EOF after it
+func (r *jsonlReader) scanErr() error {
+	if err := r.scanner.Err(); err != nil && !r.failed {
+		r.failed = true
+		return err
+	}
+	return io.EOF
+}
+
+func (r *jsonlReader) Close() error {
+	return r.f.Close()
+}
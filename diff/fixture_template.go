@@ -0,0 +1,139 @@
+package diff
+
+import (
+	"bytes"
+	crand "crypto/rand"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"os"
+	"sort"
+	"strings"
+	"text/template"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const letters = "abcdefghijklmnopqrstuvwxyz0123456789"
+
+// newFixtureFuncs returns the functions available to the cells of a fixture,
+// i.e. {"email": "user-{{randString 8}}@example.com"}. Functions with the same
+// seed and time return the same values, so that every target of a row
+// receives identical values.
+func newFixtureFuncs(seed int64, now time.Time) template.FuncMap {
+	rnd := rand.New(rand.NewSource(seed))
+
+	return template.FuncMap{
+		"uuid": func() string {
+			b := make([]byte, 16)
+			rnd.Read(b)
+			b[6] = (b[6] & 0x0f) | 0x40
+			b[8] = (b[8] & 0x3f) | 0x80
+			return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+		},
+		"randInt": func(min, max int) int {
+			if max <= min {
+				return min
+			}
+			return min + rnd.Intn(max-min+1)
+		},
+		"randString": func(n int) string {
+			b := make([]byte, n)
+			for i := range b {
+				b[i] = letters[rnd.Intn(len(letters))]
+			}
+			return string(b)
+		},
+		"now":  func() time.Time { return now },
+		"unix": func() int64 { return now.Unix() },
+		// date formats a time as RFC 3339 or with the given layout, i.e. {{now | date "2006-01-02"}}
+		"date": func(args ...interface{}) (string, error) {
+			layout := time.RFC3339
+			if len(args) == 2 {
+				l, ok := args[0].(string)
+				if !ok {
+					return "", fmt.Errorf("date: invalid layout %v", args[0])
+				}
+				layout = l
+			}
+			if len(args) == 0 || len(args) > 2 {
+				return "", fmt.Errorf("date: expected 1 or 2 arguments, got %d", len(args))
+			}
+			t, ok := args[len(args)-1].(time.Time)
+			if !ok {
+				return "", fmt.Errorf("date: invalid time %v", args[len(args)-1])
+			}
+			return t.Format(layout), nil
+		},
+		"env": os.Getenv,
+	}
+}
+
+// newSeeds returns the source of the seeds of newFixtureFuncs for a run. It's
+// seeded from crypto/rand, so rows don't share a seed on coarse clocks.
+func newSeeds() *rand.Rand {
+	var b [8]byte
+	if _, err := crand.Read(b[:]); err != nil {
+		return rand.New(rand.NewSource(time.Now().UnixNano()))
+	}
+	return rand.New(rand.NewSource(int64(binary.LittleEndian.Uint64(b[:]))))
+}
+
+// renderFixture evaluates the template expressions in the cells of a fixture.
+// Cells are rendered in a fixed order, so that the same funcs and data always
+// render the same fixture.
+func renderFixture(f Fixture, data map[string]interface{}, funcs template.FuncMap) (Fixture, error) {
+	var err error
+	render := func(s string) string {
+		if err != nil || !strings.Contains(s, "{{") {
+			return s
+		}
+		var out string
+		out, err = renderCell(s, data, funcs)
+		return out
+	}
+
+	out := f
+	out.Method = render(f.Method)
+	out.Path = render(f.Path)
+	out.Body = render(f.Body)
+	if len(f.Headers) > 0 {
+		keys := make([]string, 0, len(f.Headers))
+		for k := range f.Headers {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		out.Headers = make(map[string]string, len(f.Headers))
+		for _, k := range keys {
+			out.Headers[k] = render(f.Headers[k])
+		}
+	}
+	if f.Stream != nil {
+		stream := *f.Stream
+		stream.Send = make([]json.RawMessage, len(f.Stream.Send))
+		for n, m := range f.Stream.Send {
+			stream.Send[n] = json.RawMessage(render(string(m)))
+		}
+		out.Stream = &stream
+	}
+	return out, err
+}
+
+// renderCell evaluates a cell. Cells that don't parse, such as unresolved
+// Postman {{variables}}, are sent as is.
+func renderCell(s string, data interface{}, funcs template.FuncMap) (string, error) {
+	t, err := template.New("cell").Funcs(funcs).Option("missingkey=error").Parse(s)
+	if err != nil {
+		log.Warnf("sending %q as is: %v", s, err)
+		return s, nil
+	}
+
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, data); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
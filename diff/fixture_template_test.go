@@ -0,0 +1,132 @@
+package diff
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_renderCell(t *testing.T) {
+	os.Setenv("APICMP_TEST_TOKEN", "secret")
+	defer os.Unsetenv("APICMP_TEST_TOKEN")
+
+	tests := []struct {
+		name    string
+		cell    string
+		want    *regexp.Regexp
+		wantErr bool
+	}{
+		{name: "row", cell: "user{{.row}}@example.com", want: regexp.MustCompile(`^user7@example\.com$`)},
+		{name: "uuid", cell: "{{uuid}}", want: regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)},
+		{name: "randInt", cell: "{{randInt 1 3}}", want: regexp.MustCompile(`^[1-3]$`)},
+		{name: "randString", cell: "{{randString 5}}", want: regexp.MustCompile(`^[a-z0-9]{5}$`)},
+		{name: "date", cell: "{{now | date}}", want: regexp.MustCompile(`^` + time.Now().Format("2006-01-02") + `T`)},
+		{name: "date layout", cell: `{{now | date "2006"}}`, want: regexp.MustCompile(`^` + time.Now().Format("2006") + `$`)},
+		{name: "env", cell: `Bearer {{env "APICMP_TEST_TOKEN"}}`, want: regexp.MustCompile(`^Bearer secret$`)},
+		{name: "not a template", cell: "{{baseUrl}}/users", want: regexp.MustCompile(`^\{\{baseUrl\}\}/users$`)},
+		{name: "missing key", cell: "{{.email}}", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := renderCell(tt.cell, map[string]interface{}{"row": 7}, newFixtureFuncs(1, time.Now()))
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Regexp(t, tt.want, got)
+		})
+	}
+}
+
+func Test_generateTestsTemplate(t *testing.T) {
+	testChan, err := generateTests(context.Background(), Config{
+		BeforeBasePath:  "http://before.api.com",
+		AfterBasePath:   "http://after.api.com",
+		FixtureFilePath: "./testdata/template.csv",
+		Templates:       true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []test{}
+	for t := range testChan {
+		tests = append(tests, t)
+	}
+
+	if !assert.Len(t, tests, 2) {
+		return
+	}
+	tt := tests[0]
+	assert.NoError(t, tt.err)
+	assert.Regexp(t, `^{"email": "user1-[a-z0-9]{6}@example.com", "age": \d\d}$`, tt.Before.Body)
+	assert.Equal(t, tt.Before.Body, tt.After.Body)
+	assert.Equal(t, tt.Before.Headers["X-Request-Id"], tt.After.Headers["X-Request-Id"])
+	assert.NotContains(t, tt.Before.Path, "{{")
+	assert.Equal(t, tt.Before.Path[len("http://before.api.com"):], tt.After.Path[len("http://after.api.com"):])
+
+	// the row with a missing key is errored
+	assert.Equal(t, 2, tests[1].Row)
+	assert.Error(t, tests[1].err)
+}
+
+func Test_generateTestsWithoutTemplates(t *testing.T) {
+	testChan, err := generateTests(context.Background(), Config{
+		BeforeBasePath:  "http://before.api.com",
+		AfterBasePath:   "http://after.api.com",
+		FixtureFilePath: "./testdata/template.csv",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []test{}
+	for t := range testChan {
+		tests = append(tests, t)
+	}
+
+	// cells are sent as is
+	if !assert.Len(t, tests, 2) {
+		return
+	}
+	assert.NoError(t, tests[1].err)
+	assert.Equal(t, `{"email": "{{.email}}"}`, tests[1].Before.Body)
+	assert.Contains(t, tests[0].Before.Path, "{{unix}}")
+}
+
+func Test_generateTestsTemplateRowsDiffer(t *testing.T) {
+	dir, err := ioutil.TempDir("", "apicmp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "uuid.csv")
+	err = ioutil.WriteFile(path, []byte("method,path,X-Request-Id\nPOST,/users,{{uuid}}\nPOST,/users,{{uuid}}\nPOST,/users,{{uuid}}\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testChan, err := generateTests(context.Background(), Config{
+		BeforeBasePath:  "http://before.api.com",
+		AfterBasePath:   "http://after.api.com",
+		FixtureFilePath: path,
+		Templates:       true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ids := map[string]struct{}{}
+	for tt := range testChan {
+		assert.Equal(t, tt.Before.Headers["X-Request-Id"], tt.After.Headers["X-Request-Id"])
+		ids[tt.Before.Headers["X-Request-Id"]] = struct{}{}
+	}
+	assert.Len(t, ids, 3)
+}
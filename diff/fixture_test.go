@@ -0,0 +1,248 @@
+package diff
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_generateTestsFormats(t *testing.T) {
+	tests := []struct {
+		name string
+		c    Config
+		want []test
+	}{
+		{
+			name: "JSON Lines",
+			c: Config{
+				BeforeBasePath:  "http://before.api.com",
+				AfterBasePath:   "http://after.api.com",
+				FixtureFilePath: "./testdata/get.jsonl",
+			},
+			want: []test{
+				{
+					Row:   1,
+					Route: "GET /users/{id}",
+					Before: input{
+						Method: "GET",
+						Path:   "http://before.api.com/users/1",
+						Headers: map[string]string{
+							"X-Api-Key":       "abcd",
+							"X-Forwarded-For": "192.168.1.1",
+							"Content-Type":    "application/json",
+						},
+					},
+					After: input{
+						Method: "GET",
+						Path:   "http://after.api.com/users/1",
+						Headers: map[string]string{
+							"X-Api-Key":       "abcd",
+							"X-Forwarded-For": "192.168.1.1",
+							"Content-Type":    "application/json",
+						},
+					},
+				},
+				{
+					Row:   2,
+					Route: "POST /users/create",
+					Before: input{
+						Method: "POST",
+						Path:   "http://before.api.com/users/create",
+						Headers: map[string]string{
+							"Accept":       "application/json, text/plain",
+							"Content-Type": "application/json",
+						},
+						Body: `{"email": "user1@example.com", "name": "\"quoted\""}`,
+					},
+					After: input{
+						Method: "POST",
+						Path:   "http://after.api.com/users/create",
+						Headers: map[string]string{
+							"Accept":       "application/json, text/plain",
+							"Content-Type": "application/json",
+						},
+						Body: `{"email": "user1@example.com", "name": "\"quoted\""}`,
+					},
+					Options: Options{
+						Ignore: []string{"createdAt"},
+						Match:  "superset",
+					},
+				},
+				{
+					Row:   3,
+					Route: "PUT /users/{id}/avatar",
+					Before: input{
+						Method: "PUT",
+						Path:   "http://before.api.com/users/1/avatar",
+						Headers: map[string]string{
+							"Content-Type": "application/octet-stream",
+						},
+						Body: "\x89PNG\r\n\x1a\n",
+					},
+					After: input{
+						Method: "PUT",
+						Path:   "http://after.api.com/users/1/avatar",
+						Headers: map[string]string{
+							"Content-Type": "application/octet-stream",
+						},
+						Body: "\x89PNG\r\n\x1a\n",
+					},
+				},
+			},
+		},
+		{
+			name: "HAR",
+			c: Config{
+				BeforeBasePath:  "http://before.api.com",
+				AfterBasePath:   "http://after.api.com",
+				FixtureFilePath: "./testdata/get.har",
+			},
+			want: []test{
+				{
+					Row:   1,
+					Route: "GET /users/{id}",
+					Before: input{
+						Method: "GET",
+						Path:   "http://before.api.com/users/1?expand=true",
+						Headers: map[string]string{
+							"x-api-key":    "abcd",
+							"cookie":       "a=1; b=2",
+							"Content-Type": "application/json",
+						},
+					},
+					After: input{
+						Method: "GET",
+						Path:   "http://after.api.com/users/1?expand=true",
+						Headers: map[string]string{
+							"x-api-key":    "abcd",
+							"cookie":       "a=1; b=2",
+							"Content-Type": "application/json",
+						},
+					},
+				},
+				{
+					Row:   3,
+					Route: "POST /users/create",
+					Before: input{
+						Method: "POST",
+						Path:   "http://before.api.com/users/create",
+						Headers: map[string]string{
+							"Content-Type": "application/json",
+						},
+						Body: `{"email": "user1@example.com"}`,
+					},
+					After: input{
+						Method: "POST",
+						Path:   "http://after.api.com/users/create",
+						Headers: map[string]string{
+							"Content-Type": "application/json",
+						},
+						Body: `{"email": "user1@example.com"}`,
+					},
+				},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			testChan, err := generateTests(context.Background(), tt.c)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got := []test{}
+			for t := range testChan {
+				got = append(got, t)
+			}
+
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func Test_fixtureFormat(t *testing.T) {
+	assert.Equal(t, FormatCSV, fixtureFormat(Config{FixtureFilePath: "fixtures.csv"}))
+	assert.Equal(t, FormatJSONL, fixtureFormat(Config{FixtureFilePath: "fixtures.ndjson"}))
+	assert.Equal(t, FormatHAR, fixtureFormat(Config{FixtureFilePath: "www.example.com.HAR"}))
+	assert.Equal(t, FormatJSONL, fixtureFormat(Config{FixtureFilePath: "fixtures.txt", FixtureFormat: FormatJSONL}))
+}
+
+func Test_writeFailuresJSONL(t *testing.T) {
+	dir, err := ioutil.TempDir("", "apicmp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	c := Config{
+		FixtureFilePath:  "./testdata/get.jsonl",
+		FailuresFilePath: filepath.Join(dir, "failed.jsonl"),
+	}
+	err = writeFailures(c, map[int][]string{
+		3: {"_error"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := ioutil.ReadFile(c.FailuresFilePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, `{"method":"PUT","path":"/users/1/avatar","headers":{"Content-Type":"application/octet-stream"},`+
+		`"body_base64":"iVBORw0KGgo=","original_row":3,"failed_fields":["_error"]}`+"\n", string(got))
+}
+
+func Test_jsonlReaderLineTooLong(t *testing.T) {
+	dir, err := ioutil.TempDir("", "apicmp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "long.jsonl")
+	err = ioutil.WriteFile(path, []byte(`{"path": "/users/1"}`+"\n"+
+		`{"path": "/users/2", "body": "`+strings.Repeat("a", 11*1024*1024)+`"}`+"\n"+
+		`{"path": "/users/3"}`+"\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := newJSONLReader(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	_, err = r.Read()
+	assert.NoError(t, err)
+	_, err = r.Read()
+	assert.Equal(t, bufio.ErrTooLong, err)
+	_, err = r.Read()
+	assert.Equal(t, io.EOF, err)
+
+	for _, c := range []Config{
+		{BeforeBasePath: "http://before.api.com", AfterBasePath: "http://after.api.com", FixtureFilePath: path},
+		{BeforeBasePath: "http://before.api.com", AfterBasePath: "http://after.api.com", FixtureFilePath: path, SamplePerRoute: 10},
+	} {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		tests, err := generateTests(ctx, c)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rows := []int{}
+		for tt := range tests {
+			rows = append(rows, tt.Row)
+		}
+		assert.NoError(t, ctx.Err())
+		cancel()
+		assert.Equal(t, []int{1}, rows)
+	}
+}
@@ -0,0 +1,70 @@
+package diff
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// fixtureWriter writes fixtures in a format generateTests reads
+type fixtureWriter interface {
+	Write(f Fixture) error
+	Flush() error
+}
+
+// newFixtureWriter returns a writer for the csv or jsonl format. The columns
+// of a CSV file are fixed by the header, so only the given headers are written.
+func newFixtureWriter(w io.Writer, format string, headers []string) (fixtureWriter, error) {
+	switch format {
+	case FormatCSV, "":
+		cw := &csvFixtureWriter{
+			w:       csv.NewWriter(w),
+			headers: headers,
+		}
+		return cw, cw.w.Write(append([]string{"method", "path", "body"}, headers...))
+	case FormatJSONL:
+		bw := bufio.NewWriter(w)
+		enc := json.NewEncoder(bw)
+		enc.SetEscapeHTML(false)
+		return &jsonlFixtureWriter{w: bw, enc: enc}, nil
+	default:
+		return nil, fmt.Errorf("unsupported fixture format %q", format)
+	}
+}
+
+type csvFixtureWriter struct {
+	w       *csv.Writer
+	headers []string
+}
+
+func (w *csvFixtureWriter) Write(f Fixture) error {
+	row := []string{f.Method, f.Path, f.Body}
+	for _, h := range w.headers {
+		row = append(row, f.Headers[h])
+	}
+	return w.w.Write(row)
+}
+
+func (w *csvFixtureWriter) Flush() error {
+	w.w.Flush()
+	return w.w.Error()
+}
+
+type jsonlFixtureWriter struct {
+	w   *bufio.Writer
+	enc *json.Encoder
+}
+
+func (w *jsonlFixtureWriter) Write(f Fixture) error {
+	j, err := f.jsonl()
+	if err != nil {
+		return err
+	}
+	return w.enc.Encode(j)
+}
+
+func (w *jsonlFixtureWriter) Flush() error {
+	return w.w.Flush()
+}
@@ -0,0 +1,261 @@
+package diff
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Log formats supported by gen logs
+const (
+	LogFormatNginx  = "nginx"
+	LogFormatApache = "apache"
+	LogFormatJSON   = "json"
+)
+
+// GenLogsConfig configures the fixture file generated from access logs
+type GenLogsConfig struct {
+	LogFilePaths   []string
+	LogFormat      string            // nginx, apache or json
+	Fields         map[string]string // json log fields by fixture column, i.e. path=request.uri
+	Headers        []string          // headers of combined logs: User-Agent, Referer or X-Forwarded-For
+	Methods        map[string]struct{}
+	SampleRate     int // keep 1 of every N unique requests
+	Seed           int64
+	OutputFilePath string // stdout when empty
+	Format         string // csv or jsonl. Guessed from the output file extension when empty
+	LogLevel       string
+}
+
+// combinedLog matches the nginx and apache common and combined log formats
+var combinedLog = regexp.MustCompile(`^(\S+) \S+ \S+ \[[^\]]+\] "(\S+) (\S+)[^"]*" \d{3} \S+(?: "([^"]*)" "([^"]*)")?`)
+
+// combinedLogHeaders maps headers to the submatch of combinedLog
+var combinedLogHeaders = map[string]int{
+	"X-Forwarded-For": 1,
+	"Referer":         4,
+	"User-Agent":      5,
+}
+
+// GenLogs generates a fixture file from access logs. Requests are
+// de-duplicated and optionally sampled.
+func GenLogs(c GenLogsConfig) error {
+	if c.LogLevel != "" {
+		if err := setLoglevel(c.LogLevel); err != nil {
+			return err
+		}
+	}
+
+	parse, headers, err := newLogParser(c)
+	if err != nil {
+		return err
+	}
+
+	seed := c.Seed
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	rnd := rand.New(rand.NewSource(seed))
+
+	fixtures := []Fixture{}
+	seen := map[string]struct{}{}
+	var lines, invalid int
+	for _, path := range c.LogFilePaths {
+		err := readLines(path, func(line string) {
+			lines++
+			f, ok := parse(line)
+			if !ok {
+				invalid++
+				return
+			}
+			if len(c.Methods) > 0 {
+				if _, ok := c.Methods[f.Method]; !ok {
+					return
+				}
+			}
+
+			key := fixtureKey(f)
+			if _, ok := seen[key]; ok {
+				return
+			}
+			seen[key] = struct{}{}
+
+			if c.SampleRate > 1 && rnd.Intn(c.SampleRate) != 0 {
+				return
+			}
+			fixtures = append(fixtures, f)
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	log.Infof("read %d lines, skipped %d invalid lines, wrote %d of %d unique requests", lines, invalid, len(fixtures), len(seen))
+	return writeFixtures(c.OutputFilePath, c.Format, headers, fixtures)
+}
+
+// newLogParser returns a function that parses a log line and the headers
+// that it extracts
+func newLogParser(c GenLogsConfig) (func(string) (Fixture, bool), []string, error) {
+	switch c.LogFormat {
+	case LogFormatNginx, LogFormatApache, "":
+		for _, h := range c.Headers {
+			if _, ok := combinedLogHeaders[h]; !ok {
+				return nil, nil, fmt.Errorf("header %q is not available in %s logs", h, c.LogFormat)
+			}
+		}
+
+		parse := func(line string) (Fixture, bool) {
+			m := combinedLog.FindStringSubmatch(line)
+			if m == nil || !strings.HasPrefix(m[3], "/") {
+				return Fixture{}, false
+			}
+
+			f := Fixture{
+				Method:  m[2],
+				Path:    m[3],
+				Headers: map[string]string{},
+			}
+			for _, h := range c.Headers {
+				if v := m[combinedLogHeaders[h]]; v != "" && v != "-" {
+					f.Headers[h] = v
+				}
+			}
+			return f, true
+		}
+		return parse, c.Headers, nil
+
+	case LogFormatJSON:
+		fields := map[string]string{
+			"method": "method",
+			"path":   "path",
+		}
+		headers := []string{}
+		for k, v := range c.Fields {
+			fields[k] = v
+			if strings.HasPrefix(k, "header:") {
+				headers = append(headers, strings.TrimPrefix(k, "header:"))
+			}
+		}
+		sort.Strings(headers)
+
+		parse := func(line string) (Fixture, bool) {
+			var entry map[string]interface{}
+			if err := json.Unmarshal([]byte(line), &entry); err != nil {
+				return Fixture{}, false
+			}
+
+			f := Fixture{
+				Method:  strings.ToUpper(lookupString(entry, fields["method"])),
+				Path:    lookupString(entry, fields["path"]),
+				Body:    lookupString(entry, fields["body"]),
+				Headers: map[string]string{},
+			}
+			if f.Method == "" {
+				f.Method = "GET"
+			}
+			if !strings.HasPrefix(f.Path, "/") {
+				return Fixture{}, false
+			}
+			for _, h := range headers {
+				if v := lookupString(entry, fields["header:"+h]); v != "" {
+					f.Headers[h] = v
+				}
+			}
+			return f, true
+		}
+		return parse, headers, nil
+
+	default:
+		return nil, nil, fmt.Errorf("unsupported log format %q", c.LogFormat)
+	}
+}
+
+// lookupString returns the value of a dotted path, i.e. request.headers.host
+func lookupString(entry map[string]interface{}, path string) string {
+	if path == "" {
+		return ""
+	}
+
+	var v interface{} = entry
+	for _, k := range strings.Split(path, ".") {
+		obj, ok := v.(map[string]interface{})
+		if !ok {
+			return ""
+		}
+		v = obj[k]
+	}
+
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	default:
+		buf, _ := json.Marshal(v)
+		return string(buf)
+	}
+}
+
+// fixtureKey identifies duplicate requests
+func fixtureKey(f Fixture) string {
+	keys := make([]string, 0, len(f.Headers))
+	for k := range f.Headers {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var b strings.Builder
+	b.WriteString(f.Method + " " + f.Path + "\n")
+	for _, k := range keys {
+		b.WriteString(k + ": " + f.Headers[k] + "\n")
+	}
+	b.WriteString("\n" + f.Body)
+	if f.Stream != nil {
+		stream, _ := json.Marshal(f.Stream)
+		b.WriteString("\n" + string(stream))
+	}
+	if f.Paginate != nil {
+		paginate, _ := json.Marshal(f.Paginate)
+		b.WriteString("\n" + string(paginate))
+	}
+	return b.String()
+}
+
+// readLines calls fn for every line of a plain or gzipped file
+func readLines(path string, fn func(string)) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var r io.Reader = f
+	if strings.HasSuffix(path, ".gz") {
+		gz, err := gzip.NewReader(f)
+		if err != nil {
+			return err
+		}
+		defer gz.Close()
+		r = gz
+	}
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 10*1024*1024)
+	for scanner.Scan() {
+		if line := strings.TrimSpace(scanner.Text()); line != "" {
+			fn(line)
+		}
+	}
+	return scanner.Err()
+}
@@ -0,0 +1,90 @@
+package diff
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGenLogs(t *testing.T) {
+	dir, err := ioutil.TempDir("", "apicmp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	tests := []struct {
+		name string
+		c    GenLogsConfig
+		want string
+	}{
+		{
+			name: "nginx",
+			c: GenLogsConfig{
+				LogFilePaths:   []string{"./testdata/access.log"},
+				LogFormat:      LogFormatNginx,
+				Headers:        []string{"User-Agent", "X-Forwarded-For"},
+				Methods:        map[string]struct{}{"GET": {}},
+				OutputFilePath: filepath.Join(dir, "nginx.csv"),
+			},
+			want: "method,path,body,User-Agent,X-Forwarded-For\n" +
+				"GET,/v1/pets?limit=10,,curl/7.64.1,10.0.0.1\n" +
+				"GET,/v1/pets/1,,Mozilla/5.0,10.0.0.2\n" +
+				"GET,/v1/stores/1/orders/2,,,10.0.0.5\n",
+		},
+		{
+			name: "json with field mapping",
+			c: GenLogsConfig{
+				LogFilePaths: []string{"./testdata/access.jsonl"},
+				LogFormat:    LogFormatJSON,
+				Fields: map[string]string{
+					"method":          "request.method",
+					"path":            "request.uri",
+					"body":            "request.body",
+					"header:X-Tenant": "request.headers.x-tenant",
+				},
+				OutputFilePath: filepath.Join(dir, "json.jsonl"),
+			},
+			want: `{"method":"GET","path":"/v1/pets?limit=10","headers":{"X-Tenant":"acme"}}` + "\n" +
+				`{"method":"GET","path":"/v1/pets/1"}` + "\n" +
+				`{"method":"POST","path":"/v1/pets","body":"{\"name\":\"Tom\"}"}` + "\n",
+		},
+		{
+			name: "sample",
+			c: GenLogsConfig{
+				LogFilePaths:   []string{"./testdata/access.log"},
+				LogFormat:      LogFormatNginx,
+				SampleRate:     2,
+				Seed:           4,
+				OutputFilePath: filepath.Join(dir, "sample.csv"),
+			},
+			want: "method,path,body\n" +
+				"GET,/v1/pets/1,\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := GenLogs(tt.c); err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := ioutil.ReadFile(tt.c.OutputFilePath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			assert.Equal(t, tt.want, string(got))
+		})
+	}
+}
+
+func TestGenLogsInvalidHeader(t *testing.T) {
+	err := GenLogs(GenLogsConfig{
+		LogFilePaths: []string{"./testdata/access.log"},
+		LogFormat:    LogFormatApache,
+		Headers:      []string{"Authorization"},
+	})
+	assert.EqualError(t, err, `header "Authorization" is not available in apache logs`)
+}
@@ -0,0 +1,236 @@
+package diff
+
+import (
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// GenOpenAPIConfig configures the fixture file generated from an OpenAPI spec
+type GenOpenAPIConfig struct {
+	SpecFilePath   string
+	ValuesFilePath string // parameter values by name, overriding the spec's examples
+	OutputFilePath string // stdout when empty
+	Format         string // csv or jsonl. Guessed from the output file extension when empty
+	MaxRows        int    // the maximum number of rows per operation
+	LogLevel       string
+}
+
+// GenOpenAPI generates a fixture file that covers every GET operation of an
+// OpenAPI 3 spec. Parameters are filled with the values file, the examples,
+// enums or defaults of the spec in that order.
+func GenOpenAPI(c GenOpenAPIConfig) error {
+	if c.LogLevel != "" {
+		if err := setLoglevel(c.LogLevel); err != nil {
+			return err
+		}
+	}
+
+	spec, err := loadOpenAPI(c.SpecFilePath)
+	if err != nil {
+		return err
+	}
+
+	values := map[string]interface{}{}
+	if c.ValuesFilePath != "" {
+		if err := readYAMLFile(c.ValuesFilePath, &values); err != nil {
+			return fmt.Errorf("values file: %w", err)
+		}
+	}
+
+	fixtures, headers := genOpenAPIFixtures(spec, values, c.MaxRows)
+	return writeFixtures(c.OutputFilePath, c.Format, headers, fixtures)
+}
+
+func genOpenAPIFixtures(spec *openAPI, values map[string]interface{}, maxRows int) ([]Fixture, []string) {
+	fixtures := []Fixture{}
+	headerSet := map[string]struct{}{}
+
+	for _, path := range spec.sortedPaths() {
+		item := spec.Paths[path]
+		if item.Get == nil {
+			continue
+		}
+
+		// path parameters are combined, every other parameter uses its first value
+		combinations := []map[string]string{{}}
+		query := url.Values{}
+		headers := map[string]string{}
+		for _, p := range spec.parameters(item, item.Get) {
+			vs, known := spec.parameterValues(p, values)
+			switch p.In {
+			case "path":
+				if !known {
+					log.Warnf("openapi: no value for path parameter %q of GET %s, using %q", p.Name, path, vs[0])
+				}
+				combinations = combine(combinations, p.Name, vs)
+			case "query":
+				if known || p.Required {
+					query.Set(p.Name, vs[0])
+				}
+			case "header":
+				if known || p.Required {
+					headers[p.Name] = vs[0]
+					headerSet[p.Name] = struct{}{}
+				}
+			}
+		}
+
+		for i, params := range combinations {
+			if maxRows > 0 && i >= maxRows {
+				break
+			}
+
+			p := path
+			for k, v := range params {
+				p = strings.Replace(p, "{"+k+"}", url.PathEscape(v), -1)
+			}
+			p = spec.basePath() + p
+			if len(query) > 0 {
+				p += "?" + query.Encode()
+			}
+
+			fixtures = append(fixtures, Fixture{
+				Method:  "GET",
+				Path:    p,
+				Headers: headers,
+			})
+		}
+	}
+
+	headerNames := make([]string, 0, len(headerSet))
+	for k := range headerSet {
+		headerNames = append(headerNames, k)
+	}
+	sort.Strings(headerNames)
+
+	return fixtures, headerNames
+}
+
+// combine returns every combination of the given combinations and values
+func combine(combinations []map[string]string, name string, values []string) []map[string]string {
+	out := make([]map[string]string, 0, len(combinations)*len(values))
+	for _, c := range combinations {
+		for _, v := range values {
+			next := make(map[string]string, len(c)+1)
+			for k, cv := range c {
+				next[k] = cv
+			}
+			next[name] = v
+			out = append(out, next)
+		}
+	}
+	return out
+}
+
+// parameterValues returns the values of a parameter and whether they're known.
+// A placeholder that matches the parameter's type is returned otherwise.
+func (s *openAPI) parameterValues(p *openAPIParameter, values map[string]interface{}) ([]string, bool) {
+	if v, ok := values[p.Name]; ok {
+		if list, ok := v.([]interface{}); ok {
+			return stringValues(list), true
+		}
+		return []string{stringValue(v)}, true
+	}
+
+	if p.Example != nil {
+		return []string{stringValue(p.Example)}, true
+	}
+	if len(p.Examples) > 0 {
+		names := make([]string, 0, len(p.Examples))
+		for k := range p.Examples {
+			names = append(names, k)
+		}
+		sort.Strings(names)
+
+		vs := make([]string, 0, len(names))
+		for _, k := range names {
+			vs = append(vs, stringValue(p.Examples[k].Value))
+		}
+		return vs, true
+	}
+
+	schema := s.schema(p.Schema)
+	if schema == nil {
+		return []string{p.Name}, false
+	}
+	switch {
+	case schema.Example != nil:
+		return []string{stringValue(schema.Example)}, true
+	case len(schema.Enum) > 0:
+		return stringValues(schema.Enum), true
+	case schema.Default != nil:
+		return []string{stringValue(schema.Default)}, true
+	}
+
+	switch {
+	case schema.Type == "integer" || schema.Type == "number":
+		return []string{"1"}, false
+	case schema.Type == "boolean":
+		return []string{"true"}, false
+	case schema.Format == "uuid":
+		return []string{"00000000-0000-0000-0000-000000000000"}, false
+	case schema.Format == "date":
+		return []string{"2006-01-02"}, false
+	case schema.Format == "date-time":
+		return []string{"2006-01-02T15:04:05Z"}, false
+	default:
+		return []string{p.Name}, false
+	}
+}
+
+func stringValues(list []interface{}) []string {
+	out := make([]string, 0, len(list))
+	for _, v := range list {
+		out = append(out, stringValue(v))
+	}
+	return out
+}
+
+func stringValue(v interface{}) string {
+	switch v := v.(type) {
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case []interface{}:
+		// arrays are serialized with the default "form" style
+		return strings.Join(stringValues(v), ",")
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// writeFixtures writes fixtures to a file or stdout when path is empty
+func writeFixtures(path, format string, headers []string, fixtures []Fixture) error {
+	var out io.Writer = os.Stdout
+	if path != "" && path != "-" {
+		f, err := os.Create(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		out = f
+
+		if format == "" {
+			format = fixtureFormat(Config{FixtureFilePath: path})
+		}
+	}
+
+	w, err := newFixtureWriter(out, format, headers)
+	if err != nil {
+		return err
+	}
+	for _, f := range fixtures {
+		if err := w.Write(f); err != nil {
+			return err
+		}
+	}
+	return w.Flush()
+}
@@ -0,0 +1,63 @@
+package diff
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGenOpenAPI(t *testing.T) {
+	dir, err := ioutil.TempDir("", "apicmp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	tests := []struct {
+		name string
+		c    GenOpenAPIConfig
+		want string
+	}{
+		{
+			name: "csv with values file",
+			c: GenOpenAPIConfig{
+				SpecFilePath:   "./testdata/openapi.yaml",
+				ValuesFilePath: "./testdata/values.yaml",
+				OutputFilePath: filepath.Join(dir, "fixtures.csv"),
+			},
+			want: "method,path,body,X-Tenant\n" +
+				"GET,/v1/pets?limit=20&status=available,,acme\n" +
+				"GET,/v1/pets/1,,\n" +
+				"GET,/v1/pets/2,,\n" +
+				"GET,/v1/stores/10/orders/00000000-0000-0000-0000-000000000000,,\n" +
+				"GET,/v1/stores/11/orders/00000000-0000-0000-0000-000000000000,,\n",
+		},
+		{
+			name: "jsonl with max rows",
+			c: GenOpenAPIConfig{
+				SpecFilePath:   "./testdata/openapi.yaml",
+				OutputFilePath: filepath.Join(dir, "fixtures.jsonl"),
+				MaxRows:        1,
+			},
+			want: `{"method":"GET","path":"/v1/pets?limit=20&status=available","headers":{"X-Tenant":"X-Tenant"}}` + "\n" +
+				`{"method":"GET","path":"/v1/pets/1"}` + "\n" +
+				`{"method":"GET","path":"/v1/stores/1/orders/00000000-0000-0000-0000-000000000000"}` + "\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := GenOpenAPI(tt.c); err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := ioutil.ReadFile(tt.c.OutputFilePath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			assert.Equal(t, tt.want, string(got))
+		})
+	}
+}
@@ -0,0 +1,263 @@
+package diff
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/arithran/jsondiff"
+	"github.com/itchyny/gojq"
+)
+
+// FormatGraphQL is a JSON Lines file of GraphQL operations, see graphQLFixture
+const FormatGraphQL = "graphql"
+
+const defaultGraphQLPath = "/graphql"
+
+// graphQLOperation matches the name of the first operation of a query
+var graphQLOperation = regexp.MustCompile(`^\s*(?:query|mutation|subscription)\s+([_A-Za-z][_0-9A-Za-z]*)`)
+
+type (
+	// graphQLFixture is a row of a GraphQL fixture file, i.e.
+	//
+	//	{"operationName": "GetUser", "query": "query GetUser($id: ID!) { user(id: $id) { name } }", "variables": {"id": "1"}}
+	//
+	// The path defaults to /graphql, and headers and options are read like a
+	// JSON Lines row. Rows written by --write-failures use the body instead.
+	graphQLFixture struct {
+		Query         string          `json:"query"`
+		Variables     json.RawMessage `json:"variables,omitempty"`
+		OperationName string          `json:"operationName,omitempty"`
+	}
+
+	// graphQLError is the compared part of an entry of the errors array
+	graphQLError struct {
+		Message string        `json:"message"`
+		Path    []interface{} `json:"path,omitempty"`
+		Code    interface{}   `json:"code,omitempty"` // extensions.code
+	}
+
+	graphQLReader struct {
+		*jsonlReader
+	}
+)
+
+func newGraphQLReader(path string) (*graphQLReader, error) {
+	r, err := newJSONLReader(path)
+	if err != nil {
+		return nil, err
+	}
+	return &graphQLReader{jsonlReader: r}, nil
+}
+
+// Read returns the operation as a POST of its query, variables and
+// operationName
+func (r *graphQLReader) Read() (Fixture, error) {
+	for r.scan() {
+		line := bytes.TrimSpace(r.scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+
+		var f Fixture
+		if err := json.Unmarshal(line, &f); err != nil {
+			return Fixture{}, err
+		}
+		var g graphQLFixture
+		if err := json.Unmarshal(line, &g); err != nil {
+			return Fixture{}, err
+		}
+
+		if g.Query != "" {
+			body, err := json.Marshal(g)
+			if err != nil {
+				return Fixture{}, err
+			}
+			f.Body = string(body)
+		}
+		if f.Body == "" {
+			return Fixture{}, errInvalidRow
+		}
+		if f.Path == "" {
+			f.Path = defaultGraphQLPath
+		}
+		f.Method = http.MethodPost
+		setDefaultHeaders(f.Headers)
+		return f, nil
+	}
+
+	return Fixture{}, r.scanErr()
+}
+
+// graphQLOperationName returns the operationName of a request body, or the
+// name of its query. Anonymous operations are named "anonymous".
+func graphQLOperationName(body string) string {
+	var req graphQLFixture
+	if err := json.Unmarshal([]byte(body), &req); err != nil {
+		return "anonymous"
+	}
+	if req.OperationName != "" {
+		return req.OperationName
+	}
+	if m := graphQLOperation.FindStringSubmatch(req.Query); m != nil {
+		return m[1]
+	}
+	return "anonymous"
+}
+
+// decodeGraphQL decodes a GraphQL response into the field paths of its data,
+// i.e. "GetUser:user.name", and its errors, i.e. "GetUser:errors". Arrays are
+// compared as a whole. Errors are compared by message, path and extension
+// code, regardless of their order. jq is applied to the data.
+func decodeGraphQL(raw []byte, operation string, jq *gojq.Query) (map[string]json.RawMessage, error) {
+	var resp struct {
+		Data   json.RawMessage `json:"data"`
+		Errors []struct {
+			Message    string                 `json:"message"`
+			Path       []interface{}          `json:"path"`
+			Extensions map[string]interface{} `json:"extensions"`
+		} `json:"errors"`
+	}
+	if err := json.Unmarshal(raw, &resp); err != nil {
+		return nil, err
+	}
+
+	if jq != nil {
+		data, err := graphQLJq(jq, resp.Data)
+		if err != nil {
+			return nil, err
+		}
+		resp.Data = data
+	}
+
+	body := map[string]json.RawMessage{}
+	flattenGraphQL(body, operation+":", "", resp.Data)
+
+	errs := make([]graphQLError, len(resp.Errors))
+	keys := make([]string, len(resp.Errors))
+	for i, e := range resp.Errors {
+		errs[i] = graphQLError{
+			Message: e.Message,
+			Path:    e.Path,
+			Code:    e.Extensions["code"],
+		}
+		k, _ := json.Marshal(errs[i])
+		keys[i] = string(k)
+	}
+	sort.Sort(errorsByKey{errs, keys})
+
+	enc, err := json.Marshal(errs)
+	if err != nil {
+		return nil, err
+	}
+	body[operation+":errors"] = enc
+	return body, nil
+}
+
+// graphQLJq applies jq to the data of a response. A single match replaces the
+// data, and several matches are an array.
+func graphQLJq(jq *gojq.Query, raw json.RawMessage) (json.RawMessage, error) {
+	var data interface{}
+	if len(raw) > 0 {
+		if err := json.Unmarshal(raw, &data); err != nil {
+			return nil, err
+		}
+	}
+	res, err := runJqQuery(jq, data)
+	if err != nil {
+		return nil, err
+	}
+
+	var out interface{}
+	switch len(res) {
+	case 0:
+	case 1:
+		out = res[0]
+	default:
+		out = res
+	}
+	return json.Marshal(out)
+}
+
+// flattenGraphQL adds every field of an object by its path. Anything but an
+// object, including an empty object, is a single field.
+func flattenGraphQL(body map[string]json.RawMessage, prefix, path string, raw json.RawMessage) {
+	if len(raw) == 0 {
+		raw = json.RawMessage("null")
+	}
+
+	var obj map[string]json.RawMessage
+	if raw[0] != '{' || json.Unmarshal(raw, &obj) != nil || len(obj) == 0 {
+		if path == "" {
+			path = "data"
+		}
+		body[prefix+path] = raw
+		return
+	}
+
+	for k, v := range obj {
+		p := k
+		if path != "" {
+			p = path + "." + k
+		}
+		flattenGraphQL(body, prefix, p, v)
+	}
+}
+
+// errorsByKey sorts errors by their JSON encoding
+type errorsByKey struct {
+	errs []graphQLError
+	keys []string
+}
+
+func (s errorsByKey) Len() int           { return len(s.errs) }
+func (s errorsByKey) Less(i, j int) bool { return s.keys[i] < s.keys[j] }
+func (s errorsByKey) Swap(i, j int) {
+	s.errs[i], s.errs[j] = s.errs[j], s.errs[i]
+	s.keys[i], s.keys[j] = s.keys[j], s.keys[i]
+}
+
+// graphQLOutputs decodes the bodies of GraphQL outputs by field path. Fields
+// can be ignored by their path in any operation, i.e. "user.updatedAt". An
+// exact match requires the same fields, so fields that are missing from an
+// output are compared as null. Errors always match exactly, so new errors
+// fail a superset match.
+func graphQLOutputs(outputs []output, operation string, ignore map[string]struct{},
+	wantMatch jsondiff.Difference, jq *gojq.Query) (map[string]struct{}, error) {
+	keys := map[string]struct{}{}
+	for i := range outputs {
+		body, err := decodeGraphQL(outputs[i].Raw, operation, jq)
+		if err != nil {
+			return nil, err
+		}
+		outputs[i].Body = body
+		outputs[i].Exact = map[string]struct{}{operation + ":errors": {}}
+		for k := range body {
+			keys[k] = struct{}{}
+		}
+	}
+
+	if wantMatch == jsondiff.FullMatch {
+		for i := range outputs {
+			for k := range keys {
+				if _, ok := outputs[i].Body[k]; !ok {
+					outputs[i].Body[k] = json.RawMessage("null")
+				}
+			}
+		}
+	}
+
+	merged := make(map[string]struct{}, len(ignore))
+	for k := range ignore {
+		merged[k] = struct{}{}
+	}
+	for k := range keys {
+		if _, ok := ignore[strings.TrimPrefix(k, operation+":")]; ok {
+			merged[k] = struct{}{}
+		}
+	}
+	return merged, nil
+}
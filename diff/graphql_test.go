@@ -0,0 +1,165 @@
+package diff
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/itchyny/gojq"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_graphQLReader(t *testing.T) {
+	r, err := newGraphQLReader("./testdata/graphql.jsonl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	var got []Fixture
+	var errs []error
+	for {
+		f, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		got = append(got, f)
+		errs = append(errs, err)
+	}
+
+	assert.Equal(t, []error{nil, nil, nil, errInvalidRow}, errs)
+	assert.Equal(t, Fixture{
+		Method:  "POST",
+		Path:    "/graphql",
+		Headers: map[string]string{"Content-Type": "application/json"},
+		Body:    `{"query":"query GetUser($id: ID!) { user(id: $id) { name email } }","variables":{"id":"1"},"operationName":"GetUser"}`,
+	}, got[0])
+	assert.Equal(t, "/v2/graphql", got[2].Path)
+
+	assert.Equal(t, "GetUser", graphQLOperationName(got[0].Body))
+	assert.Equal(t, "ListUsers", graphQLOperationName(got[1].Body))
+	assert.Equal(t, "anonymous", graphQLOperationName(got[2].Body))
+}
+
+func Test_decodeGraphQL(t *testing.T) {
+	tests := []struct {
+		name string
+		raw  string
+		want map[string]string
+	}{
+		{
+			name: "data",
+			raw:  `{"data": {"user": {"name": "Jane", "address": {"city": "Toronto"}, "tags": ["a"], "meta": {}}}}`,
+			want: map[string]string{
+				"GetUser:user.name":         `"Jane"`,
+				"GetUser:user.address.city": `"Toronto"`,
+				"GetUser:user.tags":         `["a"]`,
+				"GetUser:user.meta":         `{}`,
+				"GetUser:errors":            `[]`,
+			},
+		},
+		{
+			name: "errors in any order",
+			raw: `{"data": null, "errors": [
+				{"message": "not found", "path": ["user"], "locations": [{"line": 1, "column": 2}], "extensions": {"code": "NOT_FOUND", "trace": "abc"}},
+				{"message": "forbidden", "path": ["user", "email"]}
+			]}`,
+			want: map[string]string{
+				"GetUser:data":   `null`,
+				"GetUser:errors": `[{"message":"forbidden","path":["user","email"]},{"message":"not found","path":["user"],"code":"NOT_FOUND"}]`,
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := decodeGraphQL([]byte(tt.raw), "GetUser", nil)
+			if !assert.NoError(t, err) {
+				return
+			}
+			gotStr := map[string]string{}
+			for k, v := range got {
+				gotStr[k] = string(v)
+			}
+			assert.Equal(t, tt.want, gotStr)
+		})
+	}
+}
+
+func Test_graphQLCompare(t *testing.T) {
+	newServer := func(resp string) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var req graphQLFixture
+			_ = json.NewDecoder(r.Body).Decode(&req)
+			switch req.OperationName {
+			case "GetUser":
+				fmt.Fprint(w, resp)
+			default:
+				fmt.Fprint(w, `{"data": {"users": []}}`)
+			}
+		}))
+	}
+	before := newServer(`{"data": {"user": {"name": "Jane", "email": "jane@example.com"}}}`)
+	defer before.Close()
+	after := newServer(`{"data": {"user": {"name": "Jane", "email": null, "phone": "555"}}, "errors": [{"message": "forbidden", "path": ["user", "email"], "extensions": {"code": "FORBIDDEN"}}]}`)
+	defer after.Close()
+
+	tests := []struct {
+		name   string
+		match  string
+		ignore map[string]struct{}
+		jq     string
+		want   map[int][]string
+	}{
+		{
+			name:  "exact",
+			match: "exact",
+			want:  map[int][]string{1: {"GetUser:errors", "GetUser:user.email", "GetUser:user.phone"}, 2: nil, 3: nil},
+		},
+		{
+			name:   "superset ignoring a field of any operation",
+			match:  "superset",
+			ignore: map[string]struct{}{"user.email": {}},
+			want:   map[int][]string{1: {"GetUser:errors"}, 2: nil, 3: nil},
+		},
+		{
+			name:  "jq is applied to the data",
+			match: "exact",
+			jq:    ".user | {name, email}",
+			want:  map[int][]string{1: {"GetUser:email", "GetUser:errors"}, 2: nil, 3: nil},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := Config{
+				BeforeBasePath:  before.URL,
+				AfterBasePath:   after.URL,
+				FixtureFilePath: "./testdata/graphql.jsonl",
+				FixtureFormat:   FormatGraphQL,
+			}
+			tests, err := generateTests(context.Background(), c)
+			if err != nil {
+				t.Fatal(err)
+			}
+			targets, err := newTargets(c)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			wantMatch, _ := parseMatch(tt.match)
+			var jq *gojq.Query
+			if tt.jq != "" {
+				jq, _ = gojq.Parse(tt.jq)
+			}
+			got := map[int][]string{}
+			for r := range compare(context.Background(), targets, tests, tt.ignore, wantMatch, jq, nil, nil) {
+				assert.NoError(t, r.err)
+				got[r.e.Row] = newRowState(r).Fields
+			}
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
@@ -0,0 +1,466 @@
+package diff
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/itchyny/gojq"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	rpb "google.golang.org/grpc/reflection/grpc_reflection_v1"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// FormatGRPC is a JSON Lines file of gRPC calls, see grpcFixture
+const FormatGRPC = "grpc"
+
+// gRPC base paths, i.e. grpc://localhost:50051
+const (
+	grpcScheme  = "grpc://"
+	grpcsScheme = "grpcs://" // TLS
+)
+
+type (
+	// grpcFixture is a row of a gRPC fixture file, i.e.
+	//
+	//	{"service": "helloworld.Greeter", "method": "SayHello", "message": {"name": "apicmp"}}
+	//
+	// The method may also be the full method, i.e. helloworld.Greeter/SayHello.
+	// Rows written by --write-failures use path, headers and body instead.
+	grpcFixture struct {
+		Service  string            `json:"service"`
+		Method   string            `json:"method"`
+		Message  json.RawMessage   `json:"message"`
+		Metadata map[string]string `json:"metadata"`
+	}
+
+	grpcReader struct {
+		*jsonlReader
+	}
+
+	// grpcClient invokes unary methods of a gRPC target with dynamic
+	// messages. Methods are resolved with descriptor sets when given, or
+	// with server reflection otherwise.
+	grpcClient struct {
+		conn  *grpc.ClientConn
+		files *protoregistry.Files
+
+		mu      sync.Mutex
+		methods map[string]protoreflect.MethodDescriptor
+	}
+)
+
+func newGRPCReader(path string) (*grpcReader, error) {
+	r, err := newJSONLReader(path)
+	if err != nil {
+		return nil, err
+	}
+	return &grpcReader{jsonlReader: r}, nil
+}
+
+// Read returns the call as a POST to /<service>/<method> with the message
+// as the body and the metadata as headers
+func (r *grpcReader) Read() (Fixture, error) {
+	for r.scan() {
+		line := bytes.TrimSpace(r.scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+
+		var f Fixture
+		if err := json.Unmarshal(line, &f); err != nil {
+			return Fixture{}, err
+		}
+		var g grpcFixture
+		if err := json.Unmarshal(line, &g); err != nil {
+			return Fixture{}, err
+		}
+
+		if g.Service != "" || strings.Contains(g.Method, "/") {
+			method := strings.TrimPrefix(g.Method, "/")
+			if g.Service != "" {
+				method = g.Service + "/" + method
+			}
+			f.Path = "/" + method
+			if len(g.Message) > 0 {
+				f.Body = string(g.Message)
+			}
+			for k, v := range g.Metadata {
+				f.Headers[k] = v
+			}
+		}
+		f.Method = http.MethodPost
+		if f.Body == "" {
+			f.Body = "{}"
+		}
+
+		if _, _, err := splitGRPCMethod(f.Path); err != nil {
+			return Fixture{}, errInvalidRow
+		}
+		return f, nil
+	}
+
+	return Fixture{}, r.scanErr()
+}
+
+// isGRPCBase returns whether a base path is a gRPC target
+func isGRPCBase(base string) bool {
+	return strings.HasPrefix(base, grpcScheme) || strings.HasPrefix(base, grpcsScheme)
+}
+
+// splitGRPCMethod splits /<service>/<method>
+func splitGRPCMethod(path string) (string, string, error) {
+	parts := strings.Split(strings.TrimPrefix(path, "/"), "/")
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return "", "", fmt.Errorf("invalid gRPC method %q, expected <service>/<method>", path)
+	}
+	return parts[0], parts[1], nil
+}
+
+func newGRPCClient(base string, tc TargetConfig, protoSets []string) (*grpcClient, error) {
+	switch {
+	case tc.SignFilePath != "":
+		return nil, errors.New("sign isn't supported for grpc targets")
+	case tc.Proxy != "":
+		return nil, errors.New("proxy isn't supported for grpc targets")
+	case tc.Protocol != "":
+		return nil, errors.New("protocol isn't supported for grpc targets")
+	}
+
+	u, err := url.Parse(base)
+	if err != nil {
+		return nil, err
+	}
+
+	creds := insecure.NewCredentials()
+	if u.Scheme+"://" == grpcsScheme {
+		tlsConfig, err := newTLSConfig(tc)
+		if err != nil {
+			return nil, err
+		}
+		creds = credentials.NewTLS(tlsConfig)
+	}
+	opts := []grpc.DialOption{grpc.WithTransportCredentials(creds)}
+
+	// --resolve and unix sockets dial the host itself, so it isn't resolved
+	// by grpc
+	addr := u.Host
+	dial, err := newDialer(tc)
+	if err != nil {
+		return nil, err
+	}
+	if dial != nil {
+		addr = "passthrough:///" + addr
+		opts = append(opts, grpc.WithContextDialer(func(ctx context.Context, addr string) (net.Conn, error) {
+			return dial(ctx, "tcp", addr)
+		}))
+	}
+
+	conn, err := grpc.NewClient(addr, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &grpcClient{
+		conn:    conn,
+		methods: map[string]protoreflect.MethodDescriptor{},
+	}
+	if len(protoSets) > 0 {
+		c.files, err = loadProtoSets(protoSets)
+		if err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("protoset: %w", err)
+		}
+	}
+	return c, nil
+}
+
+// Close closes the connection of the client
+func (c *grpcClient) Close() error {
+	return c.conn.Close()
+}
+
+// loadProtoSets reads descriptor sets, i.e. of protoc --include_imports
+// --descriptor_set_out
+func loadProtoSets(paths []string) (*protoregistry.Files, error) {
+	set := &descriptorpb.FileDescriptorSet{}
+	seen := map[string]struct{}{}
+	for _, path := range paths {
+		raw, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		var s descriptorpb.FileDescriptorSet
+		if err := proto.Unmarshal(raw, &s); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		for _, f := range s.File {
+			if _, ok := seen[f.GetName()]; !ok {
+				seen[f.GetName()] = struct{}{}
+				set.File = append(set.File, f)
+			}
+		}
+	}
+	return protodesc.NewFiles(set)
+}
+
+// method returns the descriptor of /<service>/<method>
+func (c *grpcClient) method(ctx context.Context, path string) (protoreflect.MethodDescriptor, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if md, ok := c.methods[path]; ok {
+		return md, nil
+	}
+
+	service, method, err := splitGRPCMethod(path)
+	if err != nil {
+		return nil, err
+	}
+
+	files := c.files
+	if files == nil {
+		files, err = c.reflect(ctx, service)
+		if err != nil {
+			return nil, fmt.Errorf("reflection: %w", err)
+		}
+	}
+
+	d, err := files.FindDescriptorByName(protoreflect.FullName(service))
+	if err != nil {
+		return nil, fmt.Errorf("service %s: %w", service, err)
+	}
+	sd, ok := d.(protoreflect.ServiceDescriptor)
+	if !ok {
+		return nil, fmt.Errorf("%s isn't a service", service)
+	}
+	md := sd.Methods().ByName(protoreflect.Name(method))
+	if md == nil {
+		return nil, fmt.Errorf("service %s has no method %s", service, method)
+	}
+	if md.IsStreamingClient() || md.IsStreamingServer() {
+		return nil, fmt.Errorf("%s: streaming methods aren't supported", path)
+	}
+
+	c.methods[path] = md
+	return md, nil
+}
+
+// reflect fetches the file of a service and its dependencies with server
+// reflection
+func (c *grpcClient) reflect(ctx context.Context, service string) (*protoregistry.Files, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	stream, err := rpb.NewServerReflectionClient(c.conn).ServerReflectionInfo(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer stream.CloseSend()
+
+	files := map[string]*descriptorpb.FileDescriptorProto{}
+	fetch := func(req *rpb.ServerReflectionRequest) error {
+		if err := stream.Send(req); err != nil {
+			return err
+		}
+		resp, err := stream.Recv()
+		if err != nil {
+			return err
+		}
+		if e := resp.GetErrorResponse(); e != nil {
+			return errors.New(e.GetErrorMessage())
+		}
+		for _, raw := range resp.GetFileDescriptorResponse().GetFileDescriptorProto() {
+			var f descriptorpb.FileDescriptorProto
+			if err := proto.Unmarshal(raw, &f); err != nil {
+				return err
+			}
+			files[f.GetName()] = &f
+		}
+		return nil
+	}
+
+	err = fetch(&rpb.ServerReflectionRequest{
+		MessageRequest: &rpb.ServerReflectionRequest_FileContainingSymbol{FileContainingSymbol: service},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// servers may leave out dependencies that were sent before
+	for missing := true; missing; {
+		missing = false
+		for _, f := range files {
+			for _, dep := range f.GetDependency() {
+				if _, ok := files[dep]; ok {
+					continue
+				}
+				missing = true
+				if fd, err := protoregistry.GlobalFiles.FindFileByPath(dep); err == nil {
+					files[dep] = protodesc.ToFileDescriptorProto(fd)
+					continue
+				}
+				err := fetch(&rpb.ServerReflectionRequest{
+					MessageRequest: &rpb.ServerReflectionRequest_FileByFilename{FileByFilename: dep},
+				})
+				if err != nil {
+					return nil, fmt.Errorf("%s: %w", dep, err)
+				}
+				if _, ok := files[dep]; !ok {
+					return nil, fmt.Errorf("%s: not found", dep)
+				}
+			}
+		}
+	}
+
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	set := &descriptorpb.FileDescriptorSet{}
+	for _, name := range names {
+		set.File = append(set.File, files[name])
+	}
+	return protodesc.NewFiles(set)
+}
+
+// invoke calls a unary method and returns its status code and the response
+// message, or the status, as JSON
+func (c *grpcClient) invoke(ctx context.Context, path, body string, md metadata.MD) (string, []byte, error) {
+	m, err := c.method(ctx, path)
+	if err != nil {
+		return "", nil, err
+	}
+
+	req := dynamicpb.NewMessage(m.Input())
+	if err := protojson.Unmarshal([]byte(body), req); err != nil {
+		return "", nil, fmt.Errorf("request message: %w", err)
+	}
+	resp := dynamicpb.NewMessage(m.Output())
+
+	err = c.conn.Invoke(metadata.NewOutgoingContext(ctx, md), path, req, resp)
+	if err != nil {
+		st, ok := status.FromError(err)
+		if !ok || errors.Is(err, context.Canceled) {
+			return "", nil, err
+		}
+		raw, err := json.Marshal(map[string]interface{}{
+			"code":    st.Code().String(),
+			"message": st.Message(),
+		})
+		return st.Code().String(), raw, err
+	}
+
+	raw, err := protojson.MarshalOptions{EmitUnpopulated: true}.Marshal(resp)
+	return "OK", raw, err
+}
+
+// newGRPCOutput calls a gRPC target. The status code is compared like the
+// status of HTTP responses, and the response message like a JSON body.
+func newGRPCOutput(ctx context.Context, t *target, i input, jq *gojq.Query) (output, error) {
+	o := output{
+		ContentType: "application/grpc",
+		Proto:       "gRPC",
+	}
+
+	u, err := url.Parse(i.Path)
+	if err != nil {
+		return o, err
+	}
+
+	md := metadata.MD{}
+	for k, v := range i.Headers {
+		if strings.EqualFold(k, "Content-Type") {
+			continue
+		}
+		md.Append(k, v)
+	}
+	if t.auth != nil {
+		token, err := t.auth.Token(ctx)
+		if err != nil {
+			return o, fmt.Errorf("%s auth: %w", t.name, err)
+		}
+		md.Set(t.auth.header, t.auth.prefix+token)
+	}
+
+	o.Code, o.Raw, err = t.grpc.invoke(ctx, u.Path, i.Body, md)
+	if err != nil {
+		return o, fmt.Errorf("%s: %w", t.name, err)
+	}
+	o.Body, err = decodeBody(o.Raw, jq)
+	if err != nil {
+		return o, err
+	}
+	return o, nil
+}
+
+// grpcurlOptions returns the grpcurl options that reproduce a target's config
+func grpcurlOptions(base string, tc TargetConfig, protoSets []string) []string {
+	var opts []string
+	if strings.HasPrefix(base, grpcScheme) {
+		opts = append(opts, "-plaintext")
+	}
+	if tc.Insecure {
+		opts = append(opts, "-insecure")
+	}
+	if tc.CACertFile != "" {
+		opts = append(opts, "-cacert '"+tc.CACertFile+"'")
+	}
+	if tc.CertFile != "" {
+		opts = append(opts, "-cert '"+tc.CertFile+"'")
+	}
+	if tc.KeyFile != "" {
+		opts = append(opts, "-key '"+tc.KeyFile+"'")
+	}
+	for _, path := range protoSets {
+		opts = append(opts, "-protoset '"+path+"'")
+	}
+	return opts
+}
+
+// grpcurl returns the grpcurl command of a gRPC input
+func grpcurl(i input) string {
+	u, err := url.Parse(i.Path)
+	if err != nil {
+		return ""
+	}
+
+	var b strings.Builder
+	b.WriteString("grpcurl")
+	for _, o := range i.CurlOptions {
+		b.WriteString(" \\\n" + o)
+	}
+	keys := make([]string, 0, len(i.Headers))
+	for k := range i.Headers {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		if strings.EqualFold(k, "Content-Type") {
+			continue
+		}
+		fmt.Fprintf(&b, " \\\n-H '%s: %s'", k, i.Headers[k])
+	}
+	fmt.Fprintf(&b, " \\\n-d '%s' \\\n%s %s", i.Body, u.Host, strings.TrimPrefix(u.Path, "/"))
+	return b.String()
+}
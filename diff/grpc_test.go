@@ -0,0 +1,172 @@
+package diff
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/reflection"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// newHealthServer starts a gRPC health server where the users service has
+// the given status
+func newHealthServer(t *testing.T, users healthpb.HealthCheckResponse_ServingStatus, reflect bool) (string, func()) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := grpc.NewServer()
+	h := health.NewServer()
+	h.SetServingStatus("users", users)
+	healthpb.RegisterHealthServer(s, h)
+	if reflect {
+		reflection.Register(s)
+	}
+	go s.Serve(l)
+
+	return "grpc://" + l.Addr().String(), s.Stop
+}
+
+func Test_grpcReader(t *testing.T) {
+	r, err := newGRPCReader("./testdata/grpc.jsonl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	var got []Fixture
+	var errs []error
+	for {
+		f, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		got = append(got, f)
+		errs = append(errs, err)
+	}
+
+	assert.Equal(t, []error{nil, nil, nil, nil, errInvalidRow}, errs)
+	assert.Equal(t, Fixture{
+		Method:  "POST",
+		Path:    "/grpc.health.v1.Health/Check",
+		Headers: map[string]string{"x-request-id": "2"},
+		Body:    `{"service": "users"}`,
+	}, got[1])
+	assert.Equal(t, Fixture{
+		Method:      "POST",
+		Path:        "/grpc.health.v1.Health/Check",
+		Headers:     map[string]string{},
+		Body:        `{"service": ""}`,
+		OriginalRow: 1,
+	}, got[3])
+}
+
+func Test_grpcCompare(t *testing.T) {
+	dir, err := ioutil.TempDir("", "apicmp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// a descriptor set of the health service, like protoc --descriptor_set_out
+	set := &descriptorpb.FileDescriptorSet{File: []*descriptorpb.FileDescriptorProto{
+		protodesc.ToFileDescriptorProto(healthpb.File_grpc_health_v1_health_proto),
+	}}
+	raw, err := proto.Marshal(set)
+	if err != nil {
+		t.Fatal(err)
+	}
+	protoSet := filepath.Join(dir, "health.protoset")
+	if err := ioutil.WriteFile(protoSet, raw, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		reflect   bool
+		protoSets []string
+	}{
+		{name: "server reflection", reflect: true},
+		{name: "descriptor set", protoSets: []string{protoSet}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			before, stop := newHealthServer(t, healthpb.HealthCheckResponse_SERVING, tt.reflect)
+			defer stop()
+			after, stop := newHealthServer(t, healthpb.HealthCheckResponse_NOT_SERVING, tt.reflect)
+			defer stop()
+
+			c := Config{
+				BeforeBasePath:  before,
+				AfterBasePath:   after,
+				FixtureFilePath: "./testdata/grpc.jsonl",
+				FixtureFormat:   FormatGRPC,
+				ProtoSetFiles:   tt.protoSets,
+			}
+			tests, err := generateTests(context.Background(), c)
+			if err != nil {
+				t.Fatal(err)
+			}
+			targets, err := newTargets(c)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			wantMatch, _ := parseMatch("exact")
+			got := map[int][]string{}
+			codes := map[int]string{}
+			for r := range compare(context.Background(), targets, tests, nil, wantMatch, nil, nil, nil) {
+				assert.NoError(t, r.err)
+				got[r.e.Row] = newRowState(r).Fields
+				codes[r.e.Row] = r.After.Code
+			}
+
+			assert.Equal(t, map[int][]string{1: nil, 2: {"status"}, 3: nil, 4: nil}, got)
+			assert.Equal(t, map[int]string{1: "OK", 2: "OK", 3: "NotFound", 4: "OK"}, codes)
+		})
+	}
+}
+
+func Test_grpcurl(t *testing.T) {
+	i := newInput(Config{}, "before", "grpc://localhost:50051", Fixture{
+		Method:  "POST",
+		Path:    "/grpc.health.v1.Health/Check",
+		Headers: map[string]string{"x-request-id": "2"},
+		Body:    `{"service": "users"}`,
+	}, nil)
+
+	assert.Equal(t, `grpcurl \
+-plaintext \
+-H 'x-request-id: 2' \
+-d '{"service": "users"}' \
+localhost:50051 grpc.health.v1.Health/Check`, grpcurl(i))
+}
+
+func Test_newGRPCClientUnsupported(t *testing.T) {
+	tests := []struct {
+		tc      TargetConfig
+		wantErr string
+	}{
+		{tc: TargetConfig{SignFilePath: "sign.yaml"}, wantErr: "sign isn't supported for grpc targets"},
+		{tc: TargetConfig{Proxy: "socks5://localhost:1080"}, wantErr: "proxy isn't supported for grpc targets"},
+		{tc: TargetConfig{Protocol: ProtocolHTTP1}, wantErr: "protocol isn't supported for grpc targets"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.wantErr, func(t *testing.T) {
+			_, err := newGRPCClient("grpc://localhost:50051", tt.tc, nil)
+			assert.EqualError(t, err, tt.wantErr)
+		})
+	}
+}
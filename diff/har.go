@@ -0,0 +1,154 @@
+package diff
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net/url"
+	"os"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+type (
+	har struct {
+		Log harLog `json:"log"`
+	}
+	harLog struct {
+		Entries []harEntry `json:"entries"`
+	}
+	harEntry struct {
+		Request  harRequest  `json:"request"`
+		Response harResponse `json:"response"`
+	}
+	harRequest struct {
+		Method   string      `json:"method"`
+		URL      string      `json:"url"`
+		Headers  []harHeader `json:"headers"`
+		PostData *harPost    `json:"postData"`
+	}
+	harHeader struct {
+		Name  string `json:"name"`
+		Value string `json:"value"`
+	}
+	harPost struct {
+		MimeType string `json:"mimeType"`
+		Text     string `json:"text"`
+		Encoding string `json:"encoding"` // not part of the spec, but set by some proxies
+	}
+	harResponse struct {
+		Content harContent `json:"content"`
+	}
+	harContent struct {
+		MimeType string `json:"mimeType"`
+	}
+)
+
+// harSkipHeaders are set by the HTTP client or would break the comparison
+var harSkipHeaders = map[string]struct{}{
+	"host":              {},
+	"content-length":    {},
+	"connection":        {},
+	"keep-alive":        {},
+	"proxy-connection":  {},
+	"transfer-encoding": {},
+	"te":                {},
+	"upgrade":           {},
+	"accept-encoding":   {}, // go only decompresses responses when it sets this itself
+}
+
+// harReader reads the requests of a HAR file exported from browser dev tools
+// or proxies. Every entry is a row, but entries with a non JSON response such
+// as scripts and images are skipped.
+type harReader struct {
+	entries []harEntry
+	next    int
+}
+
+func newHARReader(path string) (*harReader, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var h har
+	if err := json.NewDecoder(f).Decode(&h); err != nil {
+		return nil, err
+	}
+
+	return &harReader{
+		entries: h.Log.Entries,
+	}, nil
+}
+
+func (r *harReader) Read() (Fixture, error) {
+	if r.next >= len(r.entries) {
+		return Fixture{}, io.EOF
+	}
+	e := r.entries[r.next]
+	r.next++
+
+	if mime := e.Response.Content.MimeType; mime != "" && !strings.Contains(mime, "json") {
+		log.Debugf("har: skipping %s %s with %s response", e.Request.Method, e.Request.URL, mime)
+		return Fixture{}, errSkipRow
+	}
+
+	return harToFixture(e.Request)
+}
+
+func (r *harReader) Close() error {
+	return nil
+}
+
+func harToFixture(req harRequest) (Fixture, error) {
+	u, err := url.Parse(req.URL)
+	if err != nil {
+		return Fixture{}, err
+	}
+
+	f := Fixture{
+		Method:  req.Method,
+		Path:    u.RequestURI(),
+		Headers: map[string]string{},
+	}
+	if f.Method == "" {
+		f.Method = "GET"
+	}
+
+	for _, h := range req.Headers {
+		// skip HTTP/2 pseudo headers, i.e. :authority
+		if strings.HasPrefix(h.Name, ":") {
+			continue
+		}
+		if _, ok := harSkipHeaders[strings.ToLower(h.Name)]; ok {
+			continue
+		}
+
+		sep := ", "
+		if strings.EqualFold(h.Name, "Cookie") {
+			sep = "; "
+		}
+		if v, ok := f.Headers[h.Name]; ok {
+			f.Headers[h.Name] = v + sep + h.Value
+		} else {
+			f.Headers[h.Name] = h.Value
+		}
+	}
+	setDefaultHeaders(f.Headers)
+
+	if req.PostData != nil {
+		if req.PostData.Encoding == "base64" {
+			body, err := base64.StdEncoding.DecodeString(req.PostData.Text)
+			if err != nil {
+				return Fixture{}, err
+			}
+			f.Body = string(body)
+		} else {
+			f.Body = req.PostData.Text
+		}
+	}
+
+	return f, nil
+}
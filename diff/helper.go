@@ -8,6 +8,7 @@ import (
 	"strings"
 	"unicode"
 
+	"github.com/arithran/jsondiff"
 	log "github.com/sirupsen/logrus"
 )
 
@@ -115,6 +116,18 @@ func cleanDiff(diff string) string {
 	}
 }
 
+// parseMatch converts the --match option to a jsondiff.Difference
+func parseMatch(match string) (jsondiff.Difference, error) {
+	switch match {
+	case "superset":
+		return jsondiff.SupersetMatch, nil
+	case "exact", "":
+		return jsondiff.FullMatch, nil
+	default:
+		return 0, fmt.Errorf("invalid match %q", match)
+	}
+}
+
 func setLoglevel(level string) error {
 	l, err := log.ParseLevel(level)
 	if err != nil {
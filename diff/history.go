@@ -0,0 +1,329 @@
+package diff
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/olekukonko/tablewriter"
+	log "github.com/sirupsen/logrus"
+	bolt "go.etcd.io/bbolt"
+)
+
+var runsBucket = []byte("runs")
+
+type (
+	// runRecord is a run stored in the history file
+	runRecord struct {
+		ID      uint64     `json:"id"`
+		Start   time.Time  `json:"start"`
+		End     time.Time  `json:"end"`
+		Config  runConfig  `json:"config"`
+		Rows    []rowState `json:"rows"`
+		Errored []int      `json:"errored,omitempty"`
+	}
+
+	// runConfig is the part of Config that identifies what a run compared
+	runConfig struct {
+		Before     string   `json:"before"`
+		After      string   `json:"after"`
+		Candidates []string `json:"candidates,omitempty"`
+		File       string   `json:"file,omitempty"`
+		Match      string   `json:"match,omitempty"`
+		Ignore     []string `json:"ignore,omitempty"`
+		Jq         string   `json:"jq,omitempty"`
+	}
+
+	// runTrend is the difference between two runs of the same fixtures
+	runTrend struct {
+		From, To           runRecord
+		FromSum, ToSum     Summary
+		NewlyFailing       []int
+		NewlyFixed         []int
+		NewlyFailingStr    string
+		NewlyFixedStr      string
+		NewFields          map[string][]int // rows by field that fail in To but not in From
+		FixedFields        map[string][]int // rows by field that fail in From but not in To
+		DifferentFixtures  bool
+		NotComparedRowsStr string // rows that only ran once
+	}
+)
+
+// HistoryConfig configures the history command
+type HistoryConfig struct {
+	FilePath string
+	Limit    int // the most recent runs, all when 0
+}
+
+func newRunConfig(c Config) runConfig {
+	rc := runConfig{
+		Before:     c.BeforeBasePath,
+		After:      c.AfterBasePath,
+		Candidates: c.CandidateBasePaths,
+		File:       c.FixtureFilePath,
+		Match:      c.Match,
+		Jq:         c.Jq,
+	}
+	for f := range c.IgnoreFields {
+		rc.Ignore = append(rc.Ignore, f)
+	}
+	sort.Strings(rc.Ignore)
+	return rc
+}
+
+// summary returns the totals of a run
+func (r runRecord) summary() Summary {
+	s := Summary{
+		Issues:      map[string][]int{},
+		ErroredRows: r.Errored,
+		Time:        r.End.Sub(r.Start),
+	}
+	for _, rs := range r.Rows {
+		s.add(rs)
+	}
+	s.Failed = s.Count - s.Passed
+	return s
+}
+
+// outcomes returns the failed fields of every row, nil when it passed.
+// Errored rows failed with the _error field.
+func (r runRecord) outcomes() map[int][]string {
+	out := make(map[int][]string, len(r.Rows)+len(r.Errored))
+	for _, rs := range r.Rows {
+		out[rs.Row] = rs.Fields
+	}
+	for _, row := range r.Errored {
+		out[row] = []string{"_error"}
+	}
+	return out
+}
+
+func openHistory(path string) (*bolt.DB, error) {
+	// fail instead of waiting for a run that's still writing
+	return bolt.Open(path, 0644, &bolt.Options{Timeout: time.Second})
+}
+
+// saveRun adds a run to the history file and returns its id
+func saveRun(path string, r runRecord) (uint64, error) {
+	db, err := openHistory(path)
+	if err != nil {
+		return 0, err
+	}
+	defer db.Close()
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists(runsBucket)
+		if err != nil {
+			return err
+		}
+		r.ID, err = b.NextSequence()
+		if err != nil {
+			return err
+		}
+		raw, err := json.Marshal(r)
+		if err != nil {
+			return err
+		}
+		return b.Put(runKey(r.ID), raw)
+	})
+	return r.ID, err
+}
+
+// loadRuns returns the runs of the history file, oldest first
+func loadRuns(path string) ([]runRecord, error) {
+	// bolt would create a missing file
+	if _, err := os.Stat(path); err != nil {
+		return nil, err
+	}
+	db, err := openHistory(path)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	runs := []runRecord{}
+	err = db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(runsBucket)
+		if b == nil {
+			return nil
+		}
+		return b.ForEach(func(k, v []byte) error {
+			var r runRecord
+			if err := json.Unmarshal(v, &r); err != nil {
+				return fmt.Errorf("run %d: %w", binary.BigEndian.Uint64(k), err)
+			}
+			runs = append(runs, r)
+			return nil
+		})
+	})
+	return runs, err
+}
+
+// runKey sorts runs by id
+func runKey(id uint64) []byte {
+	k := make([]byte, 8)
+	binary.BigEndian.PutUint64(k, id)
+	return k
+}
+
+// History prints the runs of the history file
+func History(c HistoryConfig) error {
+	runs, err := loadRuns(c.FilePath)
+	if err != nil {
+		return err
+	}
+	if c.Limit > 0 && len(runs) > c.Limit {
+		runs = runs[len(runs)-c.Limit:]
+	}
+
+	rows := [][]string{}
+	for _, r := range runs {
+		s := r.summary()
+		rows = append(rows, []string{
+			strconv.FormatUint(r.ID, 10),
+			r.Start.Local().Format("2006-01-02 15:04:05"),
+			s.Time.Round(time.Second).String(),
+			r.Config.Before,
+			r.Config.After,
+			r.Config.File,
+			strconv.Itoa(s.Count),
+			strconv.Itoa(s.Passed),
+			strconv.Itoa(s.Failed),
+			strconv.Itoa(len(s.ErroredRows)),
+		})
+	}
+
+	table := tablewriter.NewWriter(os.Stdout)
+	table.SetAutoFormatHeaders(false)
+	table.SetHeader([]string{"Run", "Started", "Time", "Before", "After", "File", "Tests", "Passed", "Failed", "Errored"})
+	table.SetBorder(false)
+	table.AppendBulk(rows)
+	table.Render()
+	return nil
+}
+
+// HistoryCompare prints the rows and fields that were fixed or started
+// failing between two runs
+func HistoryCompare(c HistoryConfig, from, to uint64) error {
+	runs, err := loadRuns(c.FilePath)
+	if err != nil {
+		return err
+	}
+	byID := make(map[uint64]runRecord, len(runs))
+	for _, r := range runs {
+		byID[r.ID] = r
+	}
+	for _, id := range []uint64{from, to} {
+		if _, ok := byID[id]; !ok {
+			return fmt.Errorf("run %d not found", id)
+		}
+	}
+
+	t := compareRuns(byID[from], byID[to])
+	if t.DifferentFixtures {
+		log.Warnf("run %d used %s and run %d used %s, rows are compared by number", from, t.From.Config.File, to, t.To.Config.File)
+	}
+	_ = tpl.ExecuteTemplate(os.Stdout, "trend", t)
+
+	fields := map[string]struct{}{}
+	for f := range t.NewFields {
+		fields[f] = struct{}{}
+	}
+	for f := range t.FixedFields {
+		fields[f] = struct{}{}
+	}
+	rows := [][]string{}
+	for f := range fields {
+		rows = append(rows, []string{
+			f,
+			strconv.Itoa(len(t.FixedFields[f])), Istoa(t.FixedFields[f], ","),
+			strconv.Itoa(len(t.NewFields[f])), Istoa(t.NewFields[f], ","),
+		})
+	}
+	sort.Slice(rows, func(i, j int) bool {
+		return rows[i][0] < rows[j][0]
+	})
+
+	table := tablewriter.NewWriter(os.Stdout)
+	table.SetAutoFormatHeaders(false)
+	table.SetHeader([]string{"Field", "Fixed", "Fixed Rows", "New", "New Rows"})
+	table.SetBorder(false)
+	table.AppendBulk(rows)
+	table.Render()
+	return nil
+}
+
+// compareRuns returns the trend between two runs. Rows that only ran in one
+// of them aren't compared.
+func compareRuns(from, to runRecord) runTrend {
+	t := runTrend{
+		From:              from,
+		To:                to,
+		FromSum:           from.summary(),
+		ToSum:             to.summary(),
+		NewFields:         map[string][]int{},
+		FixedFields:       map[string][]int{},
+		DifferentFixtures: from.Config.File != to.Config.File,
+	}
+
+	before, after := from.outcomes(), to.outcomes()
+	notCompared := []int{}
+	for row := range before {
+		if _, ok := after[row]; !ok {
+			notCompared = append(notCompared, row)
+		}
+	}
+	for row, fields := range after {
+		prev, ok := before[row]
+		if !ok {
+			notCompared = append(notCompared, row)
+			continue
+		}
+
+		switch {
+		case len(prev) == 0 && len(fields) > 0:
+			t.NewlyFailing = append(t.NewlyFailing, row)
+		case len(prev) > 0 && len(fields) == 0:
+			t.NewlyFixed = append(t.NewlyFixed, row)
+		}
+		for _, f := range missing(fields, prev) {
+			t.NewFields[f] = append(t.NewFields[f], row)
+		}
+		for _, f := range missing(prev, fields) {
+			t.FixedFields[f] = append(t.FixedFields[f], row)
+		}
+	}
+
+	sort.Ints(t.NewlyFailing)
+	sort.Ints(t.NewlyFixed)
+	sort.Ints(notCompared)
+	for _, rows := range t.NewFields {
+		sort.Ints(rows)
+	}
+	for _, rows := range t.FixedFields {
+		sort.Ints(rows)
+	}
+	t.NewlyFailingStr = Istoa(t.NewlyFailing, ",")
+	t.NewlyFixedStr = Istoa(t.NewlyFixed, ",")
+	t.NotComparedRowsStr = Istoa(notCompared, ",")
+	return t
+}
+
+// missing returns the fields of a that aren't in b
+func missing(a, b []string) []string {
+	in := make(map[string]struct{}, len(b))
+	for _, f := range b {
+		in[f] = struct{}{}
+	}
+	out := []string{}
+	for _, f := range a {
+		if _, ok := in[f]; !ok {
+			out = append(out, f)
+		}
+	}
+	return out
+}
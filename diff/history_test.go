@@ -0,0 +1,84 @@
+package diff
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_history(t *testing.T) {
+	dir, err := ioutil.TempDir("", "apicmp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "history.db")
+
+	// a missing file isn't created
+	_, err = loadRuns(path)
+	assert.Error(t, err)
+
+	start := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+	first := runRecord{
+		Start:  start,
+		End:    start.Add(time.Minute),
+		Config: runConfig{Before: "http://before.api.com", After: "http://after.api.com", File: "get.csv"},
+		Rows: []rowState{
+			{Row: 1, Passed: true},
+			{Row: 2, Fields: []string{"name", "price"}},
+			{Row: 3, Fields: []string{"name"}},
+			{Row: 5, Passed: true},
+		},
+		Errored: []int{4},
+	}
+	second := runRecord{
+		Start:  start.Add(time.Hour),
+		End:    start.Add(time.Hour + time.Minute),
+		Config: first.Config,
+		Rows: []rowState{
+			{Row: 1, Fields: []string{"price"}},
+			{Row: 2, Fields: []string{"name"}},
+			{Row: 3, Passed: true},
+			{Row: 4, Passed: true},
+			{Row: 6, Passed: true},
+		},
+	}
+
+	id, err := saveRun(path, first)
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(1), id)
+	id, err = saveRun(path, second)
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(2), id)
+
+	runs, err := loadRuns(path)
+	assert.NoError(t, err)
+	if !assert.Len(t, runs, 2) {
+		return
+	}
+	assert.Equal(t, uint64(1), runs[0].ID)
+	assert.Equal(t, first.Rows, runs[0].Rows)
+	assert.True(t, first.Start.Equal(runs[0].Start))
+	assert.Equal(t, 4, runs[0].summary().Count)
+	assert.Equal(t, 2, runs[0].summary().Passed)
+
+	trend := compareRuns(runs[0], runs[1])
+	assert.Equal(t, []int{1}, trend.NewlyFailing)
+	assert.Equal(t, []int{3, 4}, trend.NewlyFixed)
+	assert.Equal(t, map[string][]int{"price": {1}}, trend.NewFields)
+	assert.Equal(t, map[string][]int{
+		"_error": {4},
+		"name":   {3},
+		"price":  {2},
+	}, trend.FixedFields)
+	assert.Equal(t, "5,6", trend.NotComparedRowsStr)
+	assert.False(t, trend.DifferentFixtures)
+
+	assert.NoError(t, History(HistoryConfig{FilePath: path}))
+	assert.NoError(t, HistoryCompare(HistoryConfig{FilePath: path}, 1, 2))
+	assert.EqualError(t, HistoryCompare(HistoryConfig{FilePath: path}, 1, 3), "run 3 not found")
+}
@@ -6,6 +6,7 @@ import (
 	"io/ioutil"
 	"net/http"
 	"net/http/httputil"
+	"strings"
 
 	"github.com/hashicorp/go-retryablehttp"
 	log "github.com/sirupsen/logrus"
@@ -15,12 +16,18 @@ type httpClient interface {
 	Do(req *retryablehttp.Request) (*http.Response, error)
 }
 
-func newRetriableHTTPClient(retry map[int]struct{}) httpClient {
+func newRetriableHTTPClient(retry map[int]struct{}, tc TargetConfig) (httpClient, error) {
+	transport, err := newTransport(tc)
+	if err != nil {
+		return nil, err
+	}
+
 	c := retryablehttp.NewClient()
+	c.HTTPClient.Transport = transport
 	c.Logger = nil
 	c.RetryMax = 1
 	c.CheckRetry = newRetryPolicy(retry)
-	return c
+	return c, nil
 }
 
 func newRetryPolicy(retry map[int]struct{}) retryablehttp.CheckRetry {
@@ -42,6 +49,9 @@ func newRetryPolicy(retry map[int]struct{}) retryablehttp.CheckRetry {
 }
 
 func httpTraceReq(req *retryablehttp.Request) {
+	if !log.IsLevelEnabled(log.TraceLevel) {
+		return
+	}
 	if bs, err := req.BodyBytes(); err == nil {
 		req.Request.Body = ioutil.NopCloser(bytes.NewBuffer(bs))
 	}
@@ -50,6 +60,11 @@ func httpTraceReq(req *retryablehttp.Request) {
 	log.Tracef("---TRACE REQUEST---\n%s\n--- END ---\n\n", reqStr)
 }
 func httpTraceResp(resp *http.Response) {
-	respStr, _ := httputil.DumpResponse(resp, true)
+	if !log.IsLevelEnabled(log.TraceLevel) {
+		return
+	}
+	// the body of a stream is read by the caller
+	stream := strings.HasPrefix(resp.Header.Get("Content-Type"), "text/event-stream")
+	respStr, _ := httputil.DumpResponse(resp, !stream)
 	log.Tracef("---TRACE RESPONSE---\n%s\n--- END ---\n\n", respStr)
 }
@@ -0,0 +1,223 @@
+package diff
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+type (
+	// openAPI is the subset of an OpenAPI 3 specification used by apicmp
+	openAPI struct {
+		Servers    []openAPIServer            `json:"servers"`
+		Paths      map[string]openAPIPathItem `json:"paths"`
+		Components openAPIComponents          `json:"components"`
+	}
+	openAPIServer struct {
+		URL string `json:"url"`
+	}
+	openAPIComponents struct {
+		Schemas    map[string]*jsonSchema       `json:"schemas"`
+		Parameters map[string]*openAPIParameter `json:"parameters"`
+		Responses  map[string]*openAPIResponse  `json:"responses"`
+	}
+	openAPIPathItem struct {
+		Parameters []*openAPIParameter `json:"parameters"`
+		Get        *openAPIOperation   `json:"get"`
+		Put        *openAPIOperation   `json:"put"`
+		Post       *openAPIOperation   `json:"post"`
+		Delete     *openAPIOperation   `json:"delete"`
+		Options    *openAPIOperation   `json:"options"`
+		Head       *openAPIOperation   `json:"head"`
+		Patch      *openAPIOperation   `json:"patch"`
+	}
+	openAPIOperation struct {
+		OperationID string                      `json:"operationId"`
+		Parameters  []*openAPIParameter         `json:"parameters"`
+		Responses   map[string]*openAPIResponse `json:"responses"`
+	}
+	openAPIParameter struct {
+		Ref      string                    `json:"$ref"`
+		Name     string                    `json:"name"`
+		In       string                    `json:"in"`
+		Required bool                      `json:"required"`
+		Schema   *jsonSchema               `json:"schema"`
+		Example  interface{}               `json:"example"`
+		Examples map[string]openAPIExample `json:"examples"`
+	}
+	openAPIExample struct {
+		Value interface{} `json:"value"`
+	}
+	openAPIResponse struct {
+		Ref     string                      `json:"$ref"`
+		Content map[string]openAPIMediaType `json:"content"`
+	}
+	openAPIMediaType struct {
+		Schema *jsonSchema `json:"schema"`
+	}
+	// jsonSchema is the subset of the OpenAPI flavour of JSON Schema used by apicmp
+	jsonSchema struct {
+		Ref                  string                 `json:"$ref"`
+		Type                 string                 `json:"type"`
+		Format               string                 `json:"format"`
+		Enum                 []interface{}          `json:"enum"`
+		Example              interface{}            `json:"example"`
+		Default              interface{}            `json:"default"`
+		Nullable             bool                   `json:"nullable"`
+		Items                *jsonSchema            `json:"items"`
+		Properties           map[string]*jsonSchema `json:"properties"`
+		Required             []string               `json:"required"`
+		AdditionalProperties json.RawMessage        `json:"additionalProperties"` // a bool or a schema
+		AllOf                []*jsonSchema          `json:"allOf"`
+		OneOf                []*jsonSchema          `json:"oneOf"`
+		AnyOf                []*jsonSchema          `json:"anyOf"`
+	}
+)
+
+// operations returns the operations of a path item by HTTP method
+func (p openAPIPathItem) operations() map[string]*openAPIOperation {
+	ops := map[string]*openAPIOperation{
+		"GET":     p.Get,
+		"PUT":     p.Put,
+		"POST":    p.Post,
+		"DELETE":  p.Delete,
+		"OPTIONS": p.Options,
+		"HEAD":    p.Head,
+		"PATCH":   p.Patch,
+	}
+	for k, v := range ops {
+		if v == nil {
+			delete(ops, k)
+		}
+	}
+	return ops
+}
+
+// loadOpenAPI reads an OpenAPI 3 specification in YAML or JSON
+func loadOpenAPI(path string) (*openAPI, error) {
+	var spec openAPI
+	if err := readYAMLFile(path, &spec); err != nil {
+		return nil, fmt.Errorf("openapi: %w", err)
+	}
+	return &spec, nil
+}
+
+// sortedPaths returns the path templates in a stable order
+func (s *openAPI) sortedPaths() []string {
+	paths := make([]string, 0, len(s.Paths))
+	for k := range s.Paths {
+		paths = append(paths, k)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// basePath returns the path of the first server, i.e. /v1
+func (s *openAPI) basePath() string {
+	if len(s.Servers) == 0 {
+		return ""
+	}
+	u, err := url.Parse(s.Servers[0].URL)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSuffix(u.Path, "/")
+}
+
+// parameters merges the parameters of a path item and an operation, where
+// the operation's parameters take precedence
+func (s *openAPI) parameters(p openAPIPathItem, op *openAPIOperation) []*openAPIParameter {
+	out := []*openAPIParameter{}
+	idx := map[string]int{}
+	for _, param := range append(append([]*openAPIParameter{}, p.Parameters...), op.Parameters...) {
+		param = s.parameter(param)
+		if param == nil {
+			continue
+		}
+
+		key := param.In + ":" + param.Name
+		if i, ok := idx[key]; ok {
+			out[i] = param
+			continue
+		}
+		idx[key] = len(out)
+		out = append(out, param)
+	}
+	return out
+}
+
+func (s *openAPI) parameter(p *openAPIParameter) *openAPIParameter {
+	if p == nil || p.Ref == "" {
+		return p
+	}
+	return s.Components.Parameters[refName(p.Ref)]
+}
+
+func (s *openAPI) response(r *openAPIResponse) *openAPIResponse {
+	if r == nil || r.Ref == "" {
+		return r
+	}
+	return s.Components.Responses[refName(r.Ref)]
+}
+
+func (s *openAPI) schema(js *jsonSchema) *jsonSchema {
+	// guard against cyclic references
+	for i := 0; js != nil && js.Ref != "" && i < 32; i++ {
+		js = s.Components.Schemas[refName(js.Ref)]
+	}
+	return js
+}
+
+// refName returns the name of a local reference, i.e. #/components/schemas/Pet
+func refName(ref string) string {
+	return ref[strings.LastIndex(ref, "/")+1:]
+}
+
+// readYAMLFile decodes a YAML (or JSON) file into v using v's json tags
+func readYAMLFile(path string, v interface{}) error {
+	buf, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	var doc interface{}
+	if err := yaml.Unmarshal(buf, &doc); err != nil {
+		return err
+	}
+
+	buf, err = json.Marshal(yamlToJSON(doc))
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(buf, v)
+}
+
+// yamlToJSON converts the maps decoded by yaml to maps that can be encoded as
+// JSON, i.e. response codes are decoded as int keys
+func yamlToJSON(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for k, val := range v {
+			v[k] = yamlToJSON(val)
+		}
+		return v
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for k, val := range v {
+			m[fmt.Sprint(k)] = yamlToJSON(val)
+		}
+		return m
+	case []interface{}:
+		for i, val := range v {
+			v[i] = yamlToJSON(val)
+		}
+		return v
+	default:
+		return v
+	}
+}
@@ -0,0 +1,250 @@
+package diff
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/itchyny/gojq"
+	log "github.com/sirupsen/logrus"
+)
+
+// Pagination types of --paginate and the paginate option of rows
+const (
+	PaginateCursor = "cursor" // the next cursor is read from the body with jq
+	PaginateLink   = "link"   // the next page is the rel="next" url of the Link header
+	PaginatePage   = "page"   // a page number query param
+	PaginateOffset = "offset" // an offset query param, increased by the items of every page
+)
+
+const defaultMaxPages = 10
+
+// Paginate follows the pages of a list endpoint, i.e.
+//
+//	{"path": "/users", "paginate": {"type": "cursor", "items": ".data", "cursor": ".meta.next"}}
+//
+// The items of all pages are concatenated and compared as the response
+// {"items": [...], "pages": N}, which the jq query is applied to.
+type Paginate struct {
+	Type     string `json:"type"`                // cursor, link, page or offset
+	Items    string `json:"items,omitempty"`     // jq path of the items of a page, default: .
+	Cursor   string `json:"cursor,omitempty"`    // jq path of the next cursor, default: .next_cursor
+	Param    string `json:"param,omitempty"`     // query param of the cursor, page or offset, default: the type
+	Start    *int   `json:"start,omitempty"`     // the first page number, default: 1
+	Size     int    `json:"size,omitempty"`      // a page with fewer items is the last one
+	MaxPages int    `json:"max_pages,omitempty"` // default: 10
+}
+
+// pager returns the next page of a list
+type pager struct {
+	p      Paginate
+	items  *gojq.Query
+	cursor *gojq.Query
+	page   int
+	offset int
+}
+
+func newPager(p Paginate) (*pager, error) {
+	switch p.Type {
+	case PaginateCursor, PaginateLink, PaginatePage, PaginateOffset:
+	default:
+		return nil, fmt.Errorf("paginate: unsupported type %q", p.Type)
+	}
+	if p.Param == "" {
+		p.Param = p.Type
+	}
+	if p.MaxPages == 0 {
+		p.MaxPages = defaultMaxPages
+	}
+
+	items, err := parseQuery(p.Items, ".")
+	if err != nil {
+		return nil, fmt.Errorf("paginate items: %w", err)
+	}
+	cursor, err := parseQuery(p.Cursor, ".next_cursor")
+	if err != nil {
+		return nil, fmt.Errorf("paginate cursor: %w", err)
+	}
+	// the first page can be 0, so only a missing start is defaulted
+	page := 1
+	if p.Start != nil {
+		page = *p.Start
+	}
+	return &pager{p: p, items: items, cursor: cursor, page: page}, nil
+}
+
+// pageItems returns the items of a page body
+func (p *pager) pageItems(body interface{}) ([]interface{}, error) {
+	v, ok := p.items.Run(body).Next()
+	if err, isErr := v.(error); isErr {
+		return nil, err
+	}
+	if !ok || v == nil {
+		return nil, nil
+	}
+	items, ok := v.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("%s isn't an array", p.items)
+	}
+	return items, nil
+}
+
+// next returns the url of the next page, or an empty string after the last
+// page
+func (p *pager) next(current string, resp *http.Response, body interface{}, items []interface{}) (string, error) {
+	u, err := url.Parse(current)
+	if err != nil {
+		return "", err
+	}
+
+	var value string
+	switch p.p.Type {
+	case PaginateLink:
+		next := linkNext(resp.Header.Values("Link"))
+		if next == "" {
+			return "", nil
+		}
+		ref, err := url.Parse(next)
+		if err != nil {
+			return "", fmt.Errorf("link header: %w", err)
+		}
+		return u.ResolveReference(ref).String(), nil
+
+	case PaginateCursor:
+		v, ok := p.cursor.Run(body).Next()
+		if err, isErr := v.(error); isErr {
+			return "", err
+		}
+		if !ok || v == nil || v == "" || v == false {
+			return "", nil
+		}
+		switch c := v.(type) {
+		case string:
+			value = c
+		default:
+			raw, _ := json.Marshal(c)
+			value = string(raw)
+		}
+
+	case PaginatePage:
+		if len(items) == 0 || (p.p.Size > 0 && len(items) < p.p.Size) {
+			return "", nil
+		}
+		p.page++
+		value = strconv.Itoa(p.page)
+
+	case PaginateOffset:
+		if len(items) == 0 || (p.p.Size > 0 && len(items) < p.p.Size) {
+			return "", nil
+		}
+		p.offset += len(items)
+		value = strconv.Itoa(p.offset)
+	}
+
+	q := u.Query()
+	q.Set(p.p.Param, value)
+	u.RawQuery = q.Encode()
+	return u.String(), nil
+}
+
+// linkNext returns the rel="next" url of Link headers, see RFC 8288
+func linkNext(headers []string) string {
+	for _, h := range headers {
+		for _, link := range strings.Split(h, ",") {
+			parts := strings.Split(link, ";")
+			target := strings.TrimSpace(parts[0])
+			if !strings.HasPrefix(target, "<") || !strings.HasSuffix(target, ">") {
+				continue
+			}
+			for _, param := range parts[1:] {
+				k, v, _ := strings.Cut(strings.TrimSpace(param), "=")
+				if !strings.EqualFold(k, "rel") {
+					continue
+				}
+				for _, rel := range strings.Fields(strings.Trim(v, `"`)) {
+					if strings.EqualFold(rel, "next") {
+						return target[1 : len(target)-1]
+					}
+				}
+			}
+		}
+	}
+	return ""
+}
+
+// newPagedOutput fetches up to MaxPages pages and compares their items. When
+// the first page fails, it's compared like any other response. A list with
+// more pages is compared with "truncated": true.
+func newPagedOutput(ctx context.Context, t *target, i input, jq *gojq.Query) (output, error) {
+	o := output{}
+	first := i.Path
+
+	p, err := newPager(*i.Paginate)
+	if err != nil {
+		return o, err
+	}
+
+	items := []interface{}{}
+	pages := 0
+	next := i.Path
+	for ; next != "" && pages < p.p.MaxPages; pages++ {
+		i.Path = next
+		resp, err := t.do(ctx, i)
+		if err != nil {
+			return o, err
+		}
+		raw, err := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return o, err
+		}
+
+		if pages == 0 {
+			o.Code = resp.Status
+			o.ContentType = resp.Header.Get("Content-Type")
+			o.Proto = resp.Proto
+			if resp.StatusCode >= http.StatusMultipleChoices {
+				o.Raw = raw
+				o.Body, err = decodeBody(raw, jq)
+				return o, err
+			}
+		} else if resp.StatusCode >= http.StatusMultipleChoices {
+			return o, fmt.Errorf("page %d: %s", pages+1, resp.Status)
+		}
+
+		var body interface{}
+		if err := json.Unmarshal(raw, &body); err != nil {
+			return o, fmt.Errorf("page %d: %w", pages+1, err)
+		}
+		pageItems, err := p.pageItems(body)
+		if err != nil {
+			return o, fmt.Errorf("page %d: %w", pages+1, err)
+		}
+		items = append(items, pageItems...)
+
+		next, err = p.next(i.Path, resp, body, pageItems)
+		if err != nil {
+			return o, fmt.Errorf("page %d: %w", pages+1, err)
+		}
+	}
+
+	body := map[string]interface{}{
+		"items": items,
+		"pages": pages,
+	}
+	if next != "" {
+		log.Warnf("%s %s: stopped after %d pages, the next pages aren't compared", t.name, first, pages)
+		body["truncated"] = true
+	}
+	o.Raw, err = json.Marshal(body)
+	if err != nil {
+		return o, err
+	}
+	o.Body, err = decodeBody(o.Raw, jq)
+	return o, err
+}
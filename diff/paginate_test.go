@@ -0,0 +1,198 @@
+package diff
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/itchyny/gojq"
+	"github.com/stretchr/testify/assert"
+)
+
+// newPagedServer lists 5 users, 2 per page, by cursor, page from 1 or 0,
+// offset or Link header. The name of the 4th user is given.
+func newPagedServer(name4 string) *httptest.Server {
+	users := []map[string]interface{}{}
+	for id := 1; id <= 5; id++ {
+		name := "user" + strconv.Itoa(id)
+		if id == 4 {
+			name = name4
+		}
+		users = append(users, map[string]interface{}{"id": id, "name": name})
+	}
+	slice := func(from int) []map[string]interface{} {
+		if from >= len(users) {
+			return []map[string]interface{}{}
+		}
+		to := from + 2
+		if to > len(users) {
+			to = len(users)
+		}
+		return users[from:to]
+	}
+
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		switch r.URL.Path {
+		case "/cursor":
+			from, _ := strconv.Atoi(q.Get("cursor"))
+			var next interface{}
+			if from+2 < len(users) {
+				next = strconv.Itoa(from + 2)
+			}
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{"data": slice(from), "meta": map[string]interface{}{"next": next}})
+		case "/page", "/link":
+			page, _ := strconv.Atoi(q.Get("page"))
+			if page == 0 {
+				page = 1
+			}
+			if r.URL.Path == "/link" && page*2 < len(users) {
+				w.Header().Add("Link", fmt.Sprintf(`</link?page=%d>; rel="next", </link?page=3>; rel="last"`, page+1))
+			}
+			_ = json.NewEncoder(w).Encode(slice((page - 1) * 2))
+		case "/page0":
+			page, _ := strconv.Atoi(q.Get("page"))
+			_ = json.NewEncoder(w).Encode(slice(page * 2))
+		case "/offset":
+			offset, _ := strconv.Atoi(q.Get("offset"))
+			_ = json.NewEncoder(w).Encode(slice(offset))
+		case "/users/1":
+			_ = json.NewEncoder(w).Encode(users[0])
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `{"error": "not found"}`)
+		}
+	}))
+}
+
+func Test_newPagedOutput(t *testing.T) {
+	server := newPagedServer("user4")
+	defer server.Close()
+
+	targets, err := newTargets(Config{BeforeBasePath: server.URL, AfterBasePath: server.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	zero := 0
+	tests := []struct {
+		name      string
+		path      string
+		p         Paginate
+		wantItems int
+		wantPages int
+		wantTrunc bool
+		wantCode  string
+	}{
+		{name: "cursor", path: "/cursor", p: Paginate{Type: PaginateCursor, Items: ".data", Cursor: ".meta.next"}, wantItems: 5, wantPages: 3},
+		{name: "page until empty", path: "/page", p: Paginate{Type: PaginatePage}, wantItems: 5, wantPages: 4},
+		{name: "page until short", path: "/page", p: Paginate{Type: PaginatePage, Size: 2}, wantItems: 5, wantPages: 3},
+		{name: "page from 0", path: "/page0", p: Paginate{Type: PaginatePage, Start: &zero}, wantItems: 5, wantPages: 4},
+		{name: "offset", path: "/offset", p: Paginate{Type: PaginateOffset, Size: 2}, wantItems: 5, wantPages: 3},
+		{name: "link", path: "/link", p: Paginate{Type: PaginateLink}, wantItems: 5, wantPages: 3},
+		{name: "max pages", path: "/link", p: Paginate{Type: PaginateLink, MaxPages: 2}, wantItems: 4, wantPages: 2, wantTrunc: true},
+		{name: "max pages of the last page", path: "/link", p: Paginate{Type: PaginateLink, MaxPages: 3}, wantItems: 5, wantPages: 3},
+		{name: "failed first page", path: "/missing", p: Paginate{Type: PaginateLink}, wantCode: "404 Not Found"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := tt.p
+			o, err := newPagedOutput(context.Background(), targets[0], input{
+				Method:   "GET",
+				Path:     server.URL + tt.path,
+				Paginate: &p,
+			}, nil)
+			if !assert.NoError(t, err) {
+				return
+			}
+			if tt.wantCode != "" {
+				assert.Equal(t, tt.wantCode, o.Code)
+				return
+			}
+
+			var got struct {
+				Items     []interface{} `json:"items"`
+				Pages     int           `json:"pages"`
+				Truncated bool          `json:"truncated"`
+			}
+			_ = json.Unmarshal(o.Raw, &got)
+			assert.Len(t, got.Items, tt.wantItems)
+			assert.Equal(t, tt.wantPages, got.Pages)
+			assert.Equal(t, tt.wantTrunc, got.Truncated)
+		})
+	}
+
+	_, err = newPagedOutput(context.Background(), targets[0], input{Path: server.URL, Paginate: &Paginate{Type: "token"}}, nil)
+	assert.EqualError(t, err, `paginate: unsupported type "token"`)
+}
+
+func Test_paginateCompare(t *testing.T) {
+	before := newPagedServer("user4")
+	defer before.Close()
+	after := newPagedServer("renamed")
+	defer after.Close()
+
+	tests := []struct {
+		name     string
+		paginate *Paginate
+		rows     map[int]struct{}
+		jq       string
+		want     map[int][]string
+	}{
+		{
+			name: "rows",
+			rows: map[int]struct{}{1: {}, 2: {}},
+			want: map[int][]string{1: {"items"}, 2: {"items"}},
+		},
+		{
+			name:     "rows without paginate use --paginate",
+			paginate: &Paginate{Type: PaginateLink},
+			want:     map[int][]string{1: {"items"}, 2: {"items"}, 3: {"items"}},
+		},
+		{
+			name:     "jq",
+			paginate: &Paginate{Type: PaginateLink},
+			jq:       "{ids: [.items[].id], pages}",
+			want:     map[int][]string{1: nil, 2: nil, 3: nil},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := Config{
+				BeforeBasePath:  before.URL,
+				AfterBasePath:   after.URL,
+				FixtureFilePath: "./testdata/paginate.jsonl",
+				Paginate:        tt.paginate,
+				Rows:            tt.rows,
+			}
+			tests, err := generateTests(context.Background(), c)
+			if err != nil {
+				t.Fatal(err)
+			}
+			targets, err := newTargets(c)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var jq *gojq.Query
+			if tt.jq != "" {
+				jq, _ = gojq.Parse(tt.jq)
+			}
+			wantMatch, _ := parseMatch("exact")
+			got := map[int][]string{}
+			for r := range compare(context.Background(), targets, tests, nil, wantMatch, jq, nil, nil) {
+				assert.NoError(t, r.err)
+				got[r.e.Row] = newRowState(r).Fields
+			}
+			assert.Equal(t, tt.want, got)
+		})
+	}
+
+	assert.Equal(t, "/link?page=2", linkNext([]string{`</link?page=1>; rel="prev", </link?page=2>; rel="next"`}))
+	assert.Equal(t, "https://api.example.com/users?page=2", linkNext([]string{`<https://api.example.com/users?page=2>; rel="last next"`}))
+	assert.Equal(t, "", linkNext([]string{`</link?page=1>; rel="prev"`}))
+}
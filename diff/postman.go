@@ -12,8 +12,10 @@ import (
 
 type (
 	Collection struct {
-		Info Info   `json:"info"`
-		Item []Item `json:"item"`
+		Info     Info       `json:"info"`
+		Item     []Item     `json:"item"`
+		Auth     *Auth      `json:"auth,omitempty"`
+		Variable []Variable `json:"variable,omitempty"`
 	}
 	Info struct {
 		Name   string `json:"name"`
@@ -23,6 +25,8 @@ type (
 		Name                    string                  `json:"name"`
 		ProtocolProfileBehavior ProtocolProfileBehavior `json:"protocolProfileBehavior"`
 		Request                 Request                 `json:"request"`
+		Item                    []Item                  `json:"item,omitempty"` // a folder
+		Auth                    *Auth                   `json:"auth,omitempty"`
 	}
 	ProtocolProfileBehavior struct {
 		DisableBodyPruning bool `json:"disableBodyPruning"`
@@ -32,28 +36,64 @@ type (
 		Header []Header `json:"header"`
 		Body   Body     `json:"body"`
 		URL    URL      `json:"url"`
+		Auth   *Auth    `json:"auth,omitempty"`
 	}
 	Header struct {
-		Key   string `json:"key"`
-		Value string `json:"value"`
+		Key      string `json:"key"`
+		Value    string `json:"value"`
+		Disabled bool   `json:"disabled,omitempty"`
 	}
 	Body struct {
-		Mode string `json:"mode"`
-		Raw  string `json:"raw"`
+		Mode       string  `json:"mode"`
+		Raw        string  `json:"raw"`
+		URLEncoded []Query `json:"urlencoded,omitempty"`
 	}
 	URL struct {
-		Raw      string   `json:"raw"`
-		Protocol string   `json:"protocol"`
-		Host     []string `json:"host"`
-		Path     []string `json:"path"`
-		Query    []Query  `json:"query"`
+		Raw      string     `json:"raw"`
+		Protocol string     `json:"protocol"`
+		Host     []string   `json:"host"`
+		Path     []string   `json:"path"`
+		Query    []Query    `json:"query"`
+		Variable []Variable `json:"variable,omitempty"`
 	}
 	Query struct {
-		Key   string `json:"key"`
-		Value string `json:"value"`
+		Key      string `json:"key"`
+		Value    string `json:"value"`
+		Disabled bool   `json:"disabled,omitempty"`
+	}
+	Variable struct {
+		Key      string `json:"key"`
+		Value    string `json:"value"`
+		Disabled bool   `json:"disabled,omitempty"`
+	}
+	Auth struct {
+		Type   string     `json:"type"`
+		Bearer []Variable `json:"bearer,omitempty"`
+	}
+	// Environment is an exported Postman environment
+	Environment struct {
+		Name   string     `json:"name"`
+		Values []EnvValue `json:"values"`
+	}
+	EnvValue struct {
+		Key     string `json:"key"`
+		Value   string `json:"value"`
+		Enabled *bool  `json:"enabled,omitempty"`
 	}
 )
 
+// UnmarshalJSON accepts the url of a request as a string or an object
+func (u *URL) UnmarshalJSON(data []byte) error {
+	var raw string
+	if err := json.Unmarshal(data, &raw); err == nil {
+		*u = URL{Raw: raw}
+		return nil
+	}
+
+	type plain URL
+	return json.Unmarshal(data, (*plain)(u))
+}
+
 type Postman interface {
 	GenerateCollection(filePath string, ts []test)
 }
@@ -0,0 +1,201 @@
+package diff
+
+import (
+	"encoding/json"
+	"io"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+)
+
+var postmanVariable = regexp.MustCompile(`{{\s*([^{}\s]+)\s*}}`)
+
+// postmanReader reads the requests of a Postman v2.1 collection. Folders are
+// walked depth first and every request is a row.
+type postmanReader struct {
+	items []postmanItem
+	vars  map[string]string
+	next  int
+}
+
+// postmanItem is a request with the auth inherited from its folders
+type postmanItem struct {
+	Request Request
+	Auth    *Auth
+}
+
+func newPostmanReader(path, envPath string) (*postmanReader, error) {
+	var col Collection
+	if err := readJSONFile(path, &col); err != nil {
+		return nil, err
+	}
+
+	// environment variables take precedence over collection variables
+	vars := map[string]string{}
+	for _, v := range col.Variable {
+		if !v.Disabled {
+			vars[v.Key] = v.Value
+		}
+	}
+	if envPath != "" {
+		var env Environment
+		if err := readJSONFile(envPath, &env); err != nil {
+			return nil, err
+		}
+		for _, v := range env.Values {
+			if v.Enabled == nil || *v.Enabled {
+				vars[v.Key] = v.Value
+			}
+		}
+	}
+
+	return &postmanReader{
+		items: flattenItems(col.Item, col.Auth),
+		vars:  vars,
+	}, nil
+}
+
+func flattenItems(items []Item, auth *Auth) []postmanItem {
+	out := []postmanItem{}
+	for _, item := range items {
+		a := auth
+		if item.Auth != nil {
+			a = item.Auth
+		}
+
+		if item.Item != nil {
+			out = append(out, flattenItems(item.Item, a)...)
+			continue
+		}
+
+		if item.Request.Auth != nil {
+			a = item.Request.Auth
+		}
+		out = append(out, postmanItem{Request: item.Request, Auth: a})
+	}
+	return out
+}
+
+func (r *postmanReader) Read() (Fixture, error) {
+	if r.next >= len(r.items) {
+		return Fixture{}, io.EOF
+	}
+	item := r.items[r.next]
+	r.next++
+
+	req := item.Request
+	u, err := url.Parse(r.resolveURL(req.URL))
+	if err != nil {
+		return Fixture{}, err
+	}
+
+	f := Fixture{
+		Method:  req.Method,
+		Path:    u.RequestURI(),
+		Headers: map[string]string{},
+	}
+	if f.Method == "" {
+		f.Method = "GET"
+	}
+
+	if item.Auth != nil && item.Auth.Type == "bearer" {
+		for _, v := range item.Auth.Bearer {
+			if v.Key == "token" {
+				f.Headers["Authorization"] = "Bearer " + r.resolve(v.Value)
+			}
+		}
+	}
+	for _, h := range req.Header {
+		if !h.Disabled {
+			f.Headers[r.resolve(h.Key)] = r.resolve(h.Value)
+		}
+	}
+
+	switch req.Body.Mode {
+	case "raw":
+		f.Body = r.resolve(req.Body.Raw)
+	case "urlencoded":
+		form := url.Values{}
+		for _, q := range req.Body.URLEncoded {
+			if !q.Disabled {
+				form.Add(r.resolve(q.Key), r.resolve(q.Value))
+			}
+		}
+		f.Body = form.Encode()
+		f.Headers["Content-Type"] = "application/x-www-form-urlencoded"
+	}
+	setDefaultHeaders(f.Headers)
+
+	return f, nil
+}
+
+func (r *postmanReader) Close() error {
+	return nil
+}
+
+// postmanDynamicVariables maps Postman's dynamic variables to fixture template functions
+var postmanDynamicVariables = map[string]string{
+	"$guid":         "{{uuid}}",
+	"$randomUUID":   "{{uuid}}",
+	"$timestamp":    "{{unix}}",
+	"$isoTimestamp": "{{now | date}}",
+	"$randomInt":    "{{randInt 0 1000}}",
+}
+
+// resolve replaces {{variables}}, unknown variables are left as is
+func (r *postmanReader) resolve(s string) string {
+	return postmanVariable.ReplaceAllStringFunc(s, func(m string) string {
+		key := postmanVariable.FindStringSubmatch(m)[1]
+		if v, ok := r.vars[key]; ok {
+			return v
+		}
+		if v, ok := postmanDynamicVariables[key]; ok {
+			return v
+		}
+		return m
+	})
+}
+
+// resolveURL returns the absolute url of a request. The host is discarded
+// later, so a url without a protocol is given a placeholder one.
+func (r *postmanReader) resolveURL(u URL) string {
+	raw := u.Raw
+	if raw == "" {
+		raw = strings.Join(u.Host, ".") + "/" + strings.Join(u.Path, "/")
+		qs := []string{}
+		for _, q := range u.Query {
+			if !q.Disabled {
+				qs = append(qs, q.Key+"="+q.Value)
+			}
+		}
+		if len(qs) > 0 {
+			raw += "?" + strings.Join(qs, "&")
+		}
+	}
+
+	// path variables, i.e. /users/:id
+	for _, v := range u.Variable {
+		name := "/:" + v.Key
+		re := regexp.MustCompile(regexp.QuoteMeta(name) + `(/|\?|$)`)
+		raw = re.ReplaceAllStringFunc(raw, func(m string) string {
+			return "/" + v.Value + strings.TrimPrefix(m, name)
+		})
+	}
+
+	raw = r.resolve(raw)
+	if !strings.Contains(raw, "://") {
+		raw = "http://" + raw
+	}
+	return raw
+}
+
+func readJSONFile(path string, v interface{}) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	return json.NewDecoder(f).Decode(v)
+}
@@ -0,0 +1,50 @@
+package diff
+
+import (
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_postmanReader(t *testing.T) {
+	r, err := newPostmanReader("./testdata/collection.json", "./testdata/environment.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	want := []Fixture{
+		{
+			Method: "GET",
+			Path:   "/users/2?expand={{expand}}",
+			Headers: map[string]string{
+				"Authorization": "Bearer secret",
+				"X-Api-Key":     "abcd",
+				"Content-Type":  "application/json",
+			},
+		},
+		{
+			Method: "POST",
+			Path:   "/users/create",
+			Headers: map[string]string{
+				"Content-Type": "application/json",
+			},
+			Body: `{"email": "{{email}}"}`,
+		},
+	}
+
+	got := []Fixture{}
+	for {
+		f, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, f)
+	}
+
+	assert.Equal(t, want, got)
+}
@@ -0,0 +1,331 @@
+package diff
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/arithran/jsondiff"
+	"github.com/itchyny/gojq"
+	log "github.com/sirupsen/logrus"
+)
+
+// proxyQueueSize is the number of requests that wait to be compared. Requests
+// are still proxied when the queue is full, but they aren't compared.
+const proxyQueueSize = 1000
+
+// proxyDrainTimeout bounds the time the queued requests are compared after
+// the proxy is stopped
+const proxyDrainTimeout = time.Minute
+
+// hopHeaders aren't forwarded, see RFC 7230. Accept-Encoding is removed so
+// the transport decodes compressed responses before they're compared.
+var hopHeaders = []string{
+	"Connection",
+	"Proxy-Connection",
+	"Keep-Alive",
+	"Proxy-Authenticate",
+	"Proxy-Authorization",
+	"Te",
+	"Trailer",
+	"Transfer-Encoding",
+	"Upgrade",
+	"Accept-Encoding",
+}
+
+// ProxyConfig is the config of Proxy. The fixture options of Config are
+// unused.
+type ProxyConfig struct {
+	Config
+	Listen string // i.e. :8080
+}
+
+// proxy returns the before response of every request, and compares it with
+// the after response in the background
+type proxy struct {
+	c         Config
+	targets   []*target
+	names     []string
+	headers   map[string]string
+	jq        *gojq.Query
+	wantMatch jsondiff.Difference
+
+	ctx     context.Context // of the workers, canceled after the queue is drained
+	cancel  context.CancelFunc
+	start   time.Time
+	row     int64
+	jobs    chan result
+	results chan result
+	workers sync.WaitGroup
+	done    chan struct{}
+	sum     Summary
+}
+
+// Proxy is a reverse proxy in front of before. Every request is sent to after
+// as well, and the diffs are printed while the proxy runs. The summary is
+// printed when the context is canceled.
+func Proxy(ctx context.Context, c ProxyConfig) error {
+	err := setLoglevel(c.LogLevel)
+	if err != nil {
+		return err
+	}
+
+	p, err := newProxy(c.Config.withUnixSockets())
+	if err != nil {
+		return err
+	}
+
+	srv := &http.Server{Addr: c.Listen, Handler: p}
+	errs := make(chan error, 1)
+	go func() {
+		errs <- srv.ListenAndServe()
+	}()
+	log.Infof("proxying %s to %s, comparing with %s", c.Listen, c.BeforeBasePath, c.AfterBasePath)
+
+	select {
+	case err = <-errs:
+	case <-ctx.Done():
+		// wait for the requests in flight, so they're queued and compared
+		// by close
+		sctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		err = srv.Shutdown(sctx)
+		cancel()
+	}
+
+	printSummary(p.close(), nil)
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+	return err
+}
+
+func newProxy(c Config) (*proxy, error) {
+	if isGRPCBase(c.BeforeBasePath) || isGRPCBase(c.AfterBasePath) {
+		return nil, errors.New("proxy: grpc targets aren't supported")
+	}
+
+	var jq *gojq.Query
+	var err error
+	if c.Jq != "" {
+		jq, err = gojq.Parse(c.Jq)
+		if err != nil {
+			return nil, err
+		}
+	}
+	wantMatch, err := parseMatch(c.Match)
+	if err != nil {
+		return nil, err
+	}
+
+	c.CandidateBasePaths = nil
+	targets, err := newTargets(c)
+	if err != nil {
+		return nil, err
+	}
+	for _, t := range targets {
+		t.returnRedirects()
+	}
+
+	p := &proxy{
+		c:         c,
+		targets:   targets,
+		names:     targetNames(2),
+		headers:   parseHeaders(c.Headers),
+		jq:        jq,
+		wantMatch: wantMatch,
+		start:     time.Now(),
+		jobs:      make(chan result, proxyQueueSize),
+		results:   make(chan result),
+		done:      make(chan struct{}),
+		sum: Summary{
+			Issues: map[string][]int{},
+		},
+	}
+
+	// the queue is still compared when the proxy is stopped
+	p.ctx, p.cancel = context.WithCancel(context.Background())
+
+	threads := c.Threads
+	if threads < 1 {
+		threads = 1
+	}
+	for i := 0; i < threads; i++ {
+		p.workers.Add(1)
+		go p.compare()
+	}
+	go func() {
+		p.workers.Wait()
+		close(p.results)
+	}()
+	go p.report()
+
+	return p, nil
+}
+
+// ServeHTTP sends a request to before and returns its response. JSON
+// responses are queued to be compared with after.
+func (p *proxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	row := int(atomic.AddInt64(&p.row, 1))
+	f := Fixture{
+		Method:  r.Method,
+		Path:    r.URL.RequestURI(),
+		Headers: proxyHeaders(r),
+		Body:    string(body),
+	}
+	t := test{
+		Row:    row,
+		Before: newInput(p.c, p.names[0], p.c.BeforeBasePath, f, p.headers),
+		After:  newInput(p.c, p.names[1], p.c.AfterBasePath, f, p.headers),
+	}
+
+	resp, raw, err := pass(w, r, p.targets[0], t.Before)
+	if err != nil {
+		log.Errorf("row:%d err:%v", row, err)
+		return
+	}
+
+	before := output{
+		Code:        resp.Status,
+		ContentType: resp.Header.Get("Content-Type"),
+		Proto:       resp.Proto,
+		Raw:         raw,
+	}
+	before.Body, err = decodeBody(raw, p.jq)
+	if err != nil {
+		log.Debugf("row:%d %s %s isn't JSON, skipping", row, r.Method, f.Path)
+		return
+	}
+
+	select {
+	case p.jobs <- result{e: t, Before: before}:
+	default:
+		log.Warnf("row:%d %s %s skipped, %d requests are waiting to be compared", row, r.Method, f.Path, proxyQueueSize)
+	}
+}
+
+// compare sends the queued requests to after and compares the responses
+func (p *proxy) compare() {
+	defer p.workers.Done()
+	for res := range p.jobs {
+		r, err := execAfter(p.ctx, p.targets, res, p.c.IgnoreFields, p.wantMatch, p.jq)
+		if err != nil {
+			if errors.Is(err, context.Canceled) {
+				log.Infof("row:%d was canceled", r.e.Row)
+				continue
+			}
+
+			_ = tpl.ExecuteTemplate(os.Stdout, "curl", r.e)
+			log.Errorf("row:%d err:%v", r.e.Row, err)
+			r.err = err
+		}
+		p.results <- r
+	}
+}
+
+// report prints the diffs of every result as soon as it's compared
+func (p *proxy) report() {
+	defer close(p.done)
+	for r := range p.results {
+		if r.err != nil {
+			p.sum.ErroredRows = append(p.sum.ErroredRows, r.e.Row)
+			continue
+		}
+
+		rs := newRowState(r)
+		p.sum.add(rs)
+		if len(r.Diffs) > 0 {
+			printResult(r)
+		}
+	}
+}
+
+// close waits for the queued requests to be compared and returns the
+// summary. Requests that aren't compared within proxyDrainTimeout are
+// canceled. Requests must not be served after close.
+func (p *proxy) close() Summary {
+	close(p.jobs)
+	select {
+	case <-p.done:
+	case <-time.After(proxyDrainTimeout):
+		log.Warnf("canceling the requests that weren't compared within %s", proxyDrainTimeout)
+		p.cancel()
+		<-p.done
+	}
+	p.cancel()
+	p.sum.Time = time.Since(p.start)
+	return p.sum
+}
+
+// pass sends a request to a target and returns its response to the client.
+// The response is returned with its body, which is already read.
+func pass(w http.ResponseWriter, r *http.Request, t *target, i input) (*http.Response, []byte, error) {
+	resp, err := t.do(r.Context(), i)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+	raw, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return nil, nil, err
+	}
+
+	for k, vs := range resp.Header {
+		if isHopHeader(k) {
+			continue
+		}
+		for _, v := range vs {
+			w.Header().Add(k, v)
+		}
+	}
+	w.WriteHeader(resp.StatusCode)
+	_, _ = w.Write(raw)
+	return resp, raw, nil
+}
+
+// proxyHeaders returns the headers of a request that are forwarded
+func proxyHeaders(r *http.Request) map[string]string {
+	headers := make(map[string]string, len(r.Header)+1)
+	for k, vs := range r.Header {
+		if isHopHeader(k) {
+			continue
+		}
+		sep := ", "
+		if k == "Cookie" {
+			sep = "; "
+		}
+		headers[k] = strings.Join(vs, sep)
+	}
+
+	if ip, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		if prior, ok := headers["X-Forwarded-For"]; ok {
+			ip = fmt.Sprintf("%s, %s", prior, ip)
+		}
+		headers["X-Forwarded-For"] = ip
+	}
+	return headers
+}
+
+func isHopHeader(k string) bool {
+	for _, h := range hopHeaders {
+		if strings.EqualFold(k, h) {
+			return true
+		}
+	}
+	return false
+}
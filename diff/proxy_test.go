@@ -0,0 +1,151 @@
+package diff
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// newProxiedServer returns a user by id, echoes posted users, deletes users
+// and serves a redirect and an html page. The name of the user is given.
+func newProxiedServer(name string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodDelete {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		switch r.URL.Path {
+		case "/users/1":
+			w.Header().Set("Content-Type", "application/json")
+			w.Header().Set("X-Name", name)
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{"id": 1, "name": name})
+		case "/users":
+			body, _ := ioutil.ReadAll(r.Body)
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusCreated)
+			_, _ = w.Write(body)
+		case "/old":
+			http.Redirect(w, r, "/users/1", http.StatusFound)
+		default:
+			w.Header().Set("Content-Type", "text/html")
+			_, _ = w.Write([]byte("<html>" + name + "</html>"))
+		}
+	}))
+}
+
+func Test_proxy(t *testing.T) {
+	before := newProxiedServer("john")
+	defer before.Close()
+	after := newProxiedServer("jane")
+	defer after.Close()
+
+	p, err := newProxy(Config{
+		BeforeBasePath: before.URL,
+		AfterBasePath:  after.URL,
+		Match:          "exact",
+		Threads:        2,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(p)
+	client := srv.Client()
+	client.CheckRedirect = func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}
+
+	tests := []struct {
+		name     string
+		method   string
+		path     string
+		body     string
+		wantCode int
+		wantBody string
+		wantName string
+	}{
+		{
+			name:     "the before response is returned",
+			method:   http.MethodGet,
+			path:     "/users/1",
+			wantCode: http.StatusOK,
+			wantBody: `{"id":1,"name":"john"}` + "\n",
+			wantName: "john",
+		},
+		{
+			name:     "the body is forwarded",
+			method:   http.MethodPost,
+			path:     "/users",
+			body:     `{"name":"joe"}`,
+			wantCode: http.StatusCreated,
+			wantBody: `{"name":"joe"}`,
+		},
+		{
+			name:     "redirects are returned",
+			method:   http.MethodGet,
+			path:     "/old",
+			wantCode: http.StatusFound,
+			wantBody: `<a href="/users/1">Found</a>.` + "\n\n",
+		},
+		{
+			name:     "empty responses aren't compared",
+			method:   http.MethodDelete,
+			path:     "/users/1",
+			wantCode: http.StatusNoContent,
+			wantBody: "",
+		},
+		{
+			name:     "html isn't compared",
+			method:   http.MethodGet,
+			path:     "/",
+			wantCode: http.StatusOK,
+			wantBody: "<html>john</html>",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest(tt.method, srv.URL+tt.path, strings.NewReader(tt.body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp, err := client.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+			body, _ := ioutil.ReadAll(resp.Body)
+
+			assert.Equal(t, tt.wantCode, resp.StatusCode)
+			assert.Equal(t, tt.wantBody, string(body))
+			assert.Equal(t, tt.wantName, resp.Header.Get("X-Name"))
+		})
+	}
+
+	srv.Close()
+	sum := p.close()
+	assert.Equal(t, 2, sum.Count)
+	assert.Equal(t, 1, sum.Passed)
+	assert.Equal(t, map[string][]int{"name": {1}}, sum.Issues)
+	assert.Empty(t, sum.ErroredRows)
+}
+
+func Test_proxyHeaders(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/users", nil)
+	r.RemoteAddr = "10.0.0.2:51234"
+	r.Header.Set("Connection", "keep-alive")
+	r.Header.Set("Accept-Encoding", "gzip")
+	r.Header.Set("X-Forwarded-For", "10.0.0.1")
+	r.Header.Add("Cookie", "a=1")
+	r.Header.Add("Cookie", "b=2")
+	r.Header.Set("Authorization", "Bearer token")
+
+	assert.Equal(t, map[string]string{
+		"X-Forwarded-For": "10.0.0.1, 10.0.0.2",
+		"Cookie":          "a=1; b=2",
+		"Authorization":   "Bearer token",
+	}, proxyHeaders(r))
+}
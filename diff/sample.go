@@ -0,0 +1,212 @@
+package diff
+
+import (
+	"io"
+	"math/rand"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+var (
+	numericSegment = regexp.MustCompile(`^\d+$`)
+	uuidSegment    = regexp.MustCompile(`^(?i)[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}$`)
+)
+
+type (
+	// sampleReader drops duplicate rows and samples the rows of every route.
+	// Dropped rows are returned as errSkipRow so that row numbers don't change.
+	sampleReader struct {
+		r    fixtureReader
+		c    Config
+		rows []sampleRow
+		next int
+		read bool
+	}
+	sampleRow struct {
+		f    Fixture
+		err  error
+		keep bool
+	}
+)
+
+func newSampleReader(r fixtureReader, c Config) *sampleReader {
+	return &sampleReader{r: r, c: c}
+}
+
+func (r *sampleReader) Read() (Fixture, error) {
+	if !r.read {
+		r.read = true
+		r.sample()
+	}
+
+	if r.next >= len(r.rows) {
+		return Fixture{}, io.EOF
+	}
+	row := r.rows[r.next]
+	r.next++
+
+	if row.err != nil {
+		return Fixture{}, row.err
+	}
+	if !row.keep {
+		return Fixture{}, errSkipRow
+	}
+	return row.f, nil
+}
+
+func (r *sampleReader) Close() error {
+	return r.r.Close()
+}
+
+// sample reads every row and selects the rows to keep
+func (r *sampleReader) sample() {
+	seen := map[string]struct{}{}
+	routes := map[string][]int{}
+	order := []string{}
+	for {
+		f, err := r.r.Read()
+		if err == io.EOF {
+			break
+		}
+
+		row := sampleRow{f: f, err: err}
+		if err == nil {
+			key := fixtureKey(f)
+			if _, ok := seen[key]; !ok {
+				seen[key] = struct{}{}
+				route := f.Method + " " + normalizeRoute(f.Path)
+				if _, ok := routes[route]; !ok {
+					order = append(order, route)
+				}
+				routes[route] = append(routes[route], len(r.rows))
+			}
+		}
+		r.rows = append(r.rows, row)
+	}
+
+	if r.c.Sample == 0 && r.c.SamplePerRoute == 0 {
+		for _, route := range order {
+			for _, i := range routes[route] {
+				r.rows[i].keep = true
+			}
+		}
+		log.Infof("dropped %d duplicate rows", r.valid()-len(seen))
+		return
+	}
+
+	seed := r.c.Seed
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	rnd := rand.New(rand.NewSource(seed))
+
+	sizes := make([]int, len(order))
+	for i, route := range order {
+		sizes[i] = len(routes[route])
+	}
+	quotas := sampleQuotas(sizes, r.c.Sample, r.c.SamplePerRoute)
+
+	kept := 0
+	for i, route := range order {
+		rows := routes[route]
+		for _, j := range rnd.Perm(len(rows))[:quotas[i]] {
+			r.rows[rows[j]].keep = true
+		}
+		kept += quotas[i]
+	}
+	log.Infof("sampled %d of %d unique rows across %d routes with --seed %d", kept, len(seen), len(order), seed)
+}
+
+// valid returns the number of rows that were read without errors
+func (r *sampleReader) valid() int {
+	n := 0
+	for _, row := range r.rows {
+		if row.err == nil {
+			n++
+		}
+	}
+	return n
+}
+
+// sampleQuotas returns the number of rows to sample from groups of the given
+// sizes. Every group is capped at perGroup, then the total is spread as evenly
+// as possible, so that small groups are kept whole and hot groups are bounded.
+// Rows that can't be spread evenly go to the earliest groups.
+func sampleQuotas(sizes []int, total, perGroup int) []int {
+	quotas := make([]int, len(sizes))
+	caps := make([]int, len(sizes))
+	for i, n := range sizes {
+		caps[i] = n
+		if perGroup > 0 && n > perGroup {
+			caps[i] = perGroup
+		}
+	}
+	if total <= 0 {
+		return caps
+	}
+
+	// water filling: the highest level that every group is filled up to
+	// within the total, capped by the group
+	sum := func(level int) int {
+		n := 0
+		for _, c := range caps {
+			if c < level {
+				n += c
+			} else {
+				n += level
+			}
+		}
+		return n
+	}
+	low, high := 0, 0
+	for _, c := range caps {
+		if c > high {
+			high = c
+		}
+	}
+	if sum(high) <= total {
+		return caps
+	}
+	for low < high {
+		mid := (low + high + 1) / 2
+		if sum(mid) <= total {
+			low = mid
+		} else {
+			high = mid - 1
+		}
+	}
+
+	// the remainder is one row each for the earliest groups above the level
+	left := total - sum(low)
+	for i, c := range caps {
+		quotas[i] = c
+		if c > low {
+			quotas[i] = low
+			if left > 0 {
+				quotas[i]++
+				left--
+			}
+		}
+	}
+	return quotas
+}
+
+// normalizeRoute collapses numeric and UUID path segments and drops the
+// query string, i.e. /users/42/orders?limit=10 is /users/{id}/orders
+func normalizeRoute(path string) string {
+	if u, err := url.Parse(path); err == nil {
+		path = u.Path
+	}
+
+	segments := strings.Split(path, "/")
+	for i, s := range segments {
+		if numericSegment.MatchString(s) || uuidSegment.MatchString(s) {
+			segments[i] = "{id}"
+		}
+	}
+	return strings.Join(segments, "/")
+}
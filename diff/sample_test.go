@@ -0,0 +1,92 @@
+package diff
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_normalizeRoute(t *testing.T) {
+	tests := []struct {
+		path string
+		want string
+	}{
+		{path: "/v1/pets", want: "/v1/pets"},
+		{path: "/v1/pets/42?fields=name", want: "/v1/pets/{id}"},
+		{path: "/users/5B1E2C9A-3F4D-4E8B-9A7C-1D2E3F4A5B6C/orders/7", want: "/users/{id}/orders/{id}"},
+		{path: "/users/me", want: "/users/me"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			assert.Equal(t, tt.want, normalizeRoute(tt.path))
+		})
+	}
+}
+
+func Test_sampleQuotas(t *testing.T) {
+	tests := []struct {
+		name     string
+		sizes    []int
+		total    int
+		perGroup int
+		want     []int
+	}{
+		{name: "per group", sizes: []int{100, 3, 10}, perGroup: 5, want: []int{5, 3, 5}},
+		{name: "small groups are kept whole", sizes: []int{100, 3, 50}, total: 20, want: []int{9, 3, 8}},
+		{name: "total and per group", sizes: []int{100, 3, 50}, total: 20, perGroup: 6, want: []int{6, 3, 6}},
+		{name: "total above size", sizes: []int{2, 3}, total: 20, want: []int{2, 3}},
+		{name: "total below groups", sizes: []int{5, 5, 5}, total: 2, want: []int{1, 1, 0}},
+		{name: "remainder to the earliest groups", sizes: []int{4, 4, 4}, total: 10, want: []int{4, 3, 3}},
+		{name: "unequal groups", sizes: []int{2, 10, 6, 10}, total: 15, want: []int{2, 5, 4, 4}},
+		{name: "saturated groups", sizes: []int{1, 8, 2, 8}, total: 12, perGroup: 5, want: []int{1, 5, 2, 4}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, sampleQuotas(tt.sizes, tt.total, tt.perGroup))
+		})
+	}
+}
+
+func Test_generateTestsSample(t *testing.T) {
+	tests := []struct {
+		name string
+		c    Config
+		want []int
+	}{
+		{
+			name: "dedupe",
+			c:    Config{Dedupe: true},
+			want: []int{1, 2, 4, 5, 6, 7},
+		},
+		{
+			name: "sample per route",
+			c:    Config{SamplePerRoute: 2, Seed: 1},
+			want: []int{1, 2, 6, 7},
+		},
+		{
+			name: "sample per route with rows",
+			c:    Config{SamplePerRoute: 2, Seed: 1, Rows: map[int]struct{}{1: {}, 2: {}, 7: {}}},
+			want: []int{1, 2, 7},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := tt.c
+			c.BeforeBasePath = "http://before.api.com"
+			c.AfterBasePath = "http://after.api.com"
+			c.FixtureFilePath = "./testdata/routes.csv"
+
+			testChan, err := generateTests(context.Background(), c)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			rows := []int{}
+			for t := range testChan {
+				rows = append(rows, t.Row)
+			}
+			assert.Equal(t, tt.want, rows)
+		})
+	}
+}
@@ -0,0 +1,268 @@
+package diff
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/rand"
+	"strconv"
+	"time"
+
+	"github.com/itchyny/gojq"
+	log "github.com/sirupsen/logrus"
+)
+
+type (
+	// scenarioFile is a fixture file of multi-step scenarios, i.e.
+	//
+	//	scenarios:
+	//	  - name: users
+	//	    steps:
+	//	      - name: create
+	//	        method: POST
+	//	        path: /users
+	//	        body: {"email": "user-{{randString 8}}@example.com"}
+	//	        capture:
+	//	          id: .data.id
+	//	      - name: get
+	//	        path: /users/{{.id}}
+	scenarioFile struct {
+		Scenarios []scenario `json:"scenarios"`
+	}
+	scenario struct {
+		Name  string         `json:"name"`
+		Steps []scenarioStep `json:"steps"`
+	}
+	// scenarioStep is a fixture that can capture values from its response
+	// with jq. Captured values are available to the templates of the next
+	// steps of the same target.
+	scenarioStep struct {
+		Fixture
+		Name    string
+		Capture map[string]string
+		Row     int
+
+		captures map[string]*gojq.Query
+	}
+
+	// scenarioRun runs the steps of a scenario in order
+	scenarioRun struct {
+		c       Config
+		headers map[string]string
+		name    string
+		steps   []scenarioStep
+		seeds   *rand.Rand // the seed of every step's generated values
+	}
+)
+
+func (s *scenarioStep) UnmarshalJSON(data []byte) error {
+	if err := json.Unmarshal(data, &s.Fixture); err != nil {
+		return err
+	}
+
+	var j struct {
+		Name    string            `json:"name"`
+		Capture map[string]string `json:"capture"`
+	}
+	if err := json.Unmarshal(data, &j); err != nil {
+		return err
+	}
+	s.Name, s.Capture = j.Name, j.Capture
+	return nil
+}
+
+// loadScenarios reads a YAML or JSON scenario file. Steps are numbered as
+// rows across all scenarios, starting at 1.
+func loadScenarios(path string) ([]scenario, error) {
+	var file scenarioFile
+	if err := readYAMLFile(path, &file); err != nil {
+		return nil, err
+	}
+
+	row := 0
+	for i := range file.Scenarios {
+		s := &file.Scenarios[i]
+		if s.Name == "" {
+			s.Name = "scenario" + strconv.Itoa(i+1)
+		}
+
+		for j := range s.Steps {
+			row++
+			step := &s.Steps[j]
+			step.Row = row
+			if step.Name == "" {
+				step.Name = strconv.Itoa(j + 1)
+			}
+			if step.Path == "" {
+				return nil, fmt.Errorf("%s#%s: path is required", s.Name, step.Name)
+			}
+			setDefaultHeaders(step.Headers)
+
+			step.captures = make(map[string]*gojq.Query, len(step.Capture))
+			for k, expr := range step.Capture {
+				q, err := gojq.Parse(expr)
+				if err != nil {
+					return nil, fmt.Errorf("%s#%s: capture %s: %w", s.Name, step.Name, k, err)
+				}
+				step.captures[k] = q
+			}
+		}
+	}
+	return file.Scenarios, nil
+}
+
+// generateScenarioTests sends a test for every scenario. A scenario runs when
+// any of its steps is selected by --rows and not completed by a previous run.
+func generateScenarioTests(ctx context.Context, c Config) (<-chan test, error) {
+	scenarios, err := loadScenarios(c.FixtureFilePath)
+	if err != nil {
+		return nil, err
+	}
+	headers := parseHeaders(c.Headers)
+	seeds := newSeeds()
+
+	out := make(chan test)
+	go func() {
+		defer close(out)
+
+		for _, s := range scenarios {
+			if len(s.Steps) == 0 || !c.selected(s.Steps) {
+				continue
+			}
+
+			t := test{
+				Row:  s.Steps[0].Row,
+				Name: s.Name,
+				Scenario: &scenarioRun{
+					c:       c,
+					headers: headers,
+					name:    s.Name,
+					steps:   s.Steps,
+					seeds:   rand.New(rand.NewSource(seeds.Int63())),
+				},
+			}
+
+			select {
+			case out <- t:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return out, nil
+}
+
+// selected returns whether any step should run
+func (c Config) selected(steps []scenarioStep) bool {
+	for _, step := range steps {
+		if len(c.Rows) > 0 {
+			if _, ok := c.Rows[step.Row]; !ok {
+				continue
+			}
+		}
+		if _, ok := c.completed[step.Row]; ok {
+			continue
+		}
+		return true
+	}
+	return false
+}
+
+// run runs the steps in order and sends a result for every selected step.
+// Every target has its own captures, but the generated values of a step are
+// identical.
+func (s *scenarioRun) run(check func(test) (result, bool), results chan<- result) {
+	bases := append([]string{s.c.BeforeBasePath, s.c.AfterBasePath}, s.c.CandidateBasePaths...)
+	captures := make([]map[string]interface{}, len(bases))
+	for i := range captures {
+		captures[i] = map[string]interface{}{}
+	}
+
+	for _, step := range s.steps {
+		t, err := s.test(step, bases, captures)
+		if err != nil {
+			log.Errorf("row:%d %s err:%v", t.Row, t.Name, err)
+			if s.c.selected([]scenarioStep{step}) {
+				results <- result{e: t, err: err}
+			}
+			continue
+		}
+
+		r, ok := check(t)
+		if !ok {
+			return
+		}
+		// steps that aren't selected still run for their captures
+		if s.c.selected([]scenarioStep{step}) {
+			results <- r
+		}
+
+		if r.err == nil {
+			outputs := append([]output{r.Before, r.After}, r.Candidates...)
+			for i, o := range outputs {
+				s.capture(step, targetNames(len(outputs))[i], o, captures[i])
+			}
+		}
+	}
+}
+
+// test renders the step for every target
+func (s *scenarioRun) test(step scenarioStep, bases []string, captures []map[string]interface{}) (test, error) {
+	t := test{
+		Row:     step.Row,
+		Name:    s.name + "#" + step.Name,
+		Options: step.Options,
+		Route:   step.Method + " " + normalizeRoute(step.Path),
+	}
+
+	seed, now := s.seeds.Int63(), time.Now()
+	names := targetNames(len(bases))
+	inputs := make([]input, len(bases))
+	for i, base := range bases {
+		data := map[string]interface{}{"row": step.Row}
+		for k, v := range captures[i] {
+			data[k] = v
+		}
+
+		f, err := renderFixture(step.Fixture, data, newFixtureFuncs(seed, now))
+		if err != nil {
+			return t, err
+		}
+		inputs[i] = newInput(s.c, names[i], base, f, s.headers)
+	}
+
+	t.Before, t.After, t.Candidates = inputs[0], inputs[1], inputs[2:]
+	return t, nil
+}
+
+// capture runs the capture queries of a step against the body of a target
+func (s *scenarioRun) capture(step scenarioStep, target string, o output, captures map[string]interface{}) {
+	if len(step.captures) == 0 {
+		return
+	}
+
+	var body interface{}
+	if err := json.Unmarshal(o.Raw, &body); err != nil {
+		log.Warnf("row:%d %s#%s: can't capture from the %s response: %v", step.Row, s.name, step.Name, target, err)
+		return
+	}
+
+	for k, q := range step.captures {
+		v, ok := q.Run(body).Next()
+		if err, isErr := v.(error); isErr {
+			log.Warnf("row:%d %s#%s: capture %s from the %s response: %v", step.Row, s.name, step.Name, k, target, err)
+			continue
+		}
+		if !ok || v == nil {
+			log.Warnf("row:%d %s#%s: capture %s from the %s response: no value", step.Row, s.name, step.Name, k, target)
+			continue
+		}
+		// integers, i.e. IDs, would be rendered as 1e+06 otherwise
+		if n, ok := v.(float64); ok && n == math.Trunc(n) && math.Abs(n) < 1<<53 {
+			v = int64(n)
+		}
+		captures[k] = v
+	}
+}
@@ -0,0 +1,114 @@
+package diff
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_loadScenarios(t *testing.T) {
+	scenarios, err := loadScenarios("./testdata/scenario.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	names := []string{}
+	rows := []int{}
+	for _, s := range scenarios {
+		for _, step := range s.Steps {
+			names = append(names, s.Name+"#"+step.Name)
+			rows = append(rows, step.Row)
+		}
+	}
+	assert.Equal(t, []string{"users#create", "users#get", "users#delete", "scenario2#1"}, names)
+	assert.Equal(t, []int{1, 2, 3, 4}, rows)
+	assert.Equal(t, "POST", scenarios[0].Steps[0].Method)
+	assert.Equal(t, "GET", scenarios[0].Steps[1].Method)
+	assert.Equal(t, map[string]string{"id": ".id"}, scenarios[0].Steps[0].Capture)
+}
+
+// newUsersServer returns a server that creates users with IDs starting at id
+func newUsersServer(id int) *httptest.Server {
+	var mu sync.Mutex
+	users := map[string]string{}
+
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		w.Header().Set("Content-Type", "application/json")
+		switch {
+		case r.Method == http.MethodPost && r.URL.Path == "/users":
+			body, _ := ioutil.ReadAll(r.Body)
+			key := fmt.Sprint(id)
+			users[key] = string(body)
+			id++
+			fmt.Fprintf(w, `{"id": %s, "user": %s}`, key, body)
+		case strings.HasPrefix(r.URL.Path, "/users/"):
+			key := strings.TrimPrefix(r.URL.Path, "/users/")
+			body, ok := users[key]
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+				fmt.Fprint(w, `{"error": "not found"}`)
+				return
+			}
+			if r.Method == http.MethodDelete {
+				delete(users, key)
+				w.WriteHeader(http.StatusNoContent)
+				return
+			}
+			fmt.Fprintf(w, `{"id": %s, "user": %s}`, key, body)
+		default:
+			fmt.Fprint(w, `{"status": "ok"}`)
+		}
+	}))
+}
+
+func Test_scenarioRun(t *testing.T) {
+	before := newUsersServer(1)
+	defer before.Close()
+	after := newUsersServer(1000000)
+	defer after.Close()
+
+	c := Config{
+		BeforeBasePath:  before.URL,
+		AfterBasePath:   after.URL,
+		FixtureFilePath: "./testdata/scenario.yaml",
+		Rows:            map[int]struct{}{1: {}, 2: {}, 3: {}},
+	}
+	tests, err := generateTests(context.Background(), c)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wantMatch, _ := parseMatch("exact")
+	got := map[string][]string{}
+	paths := map[string]string{}
+	codes := map[string]string{}
+	targets, err := newTargets(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for r := range compare(context.Background(), targets, tests, nil, wantMatch, nil, nil, nil) {
+		assert.NoError(t, r.err)
+		got[r.e.Name] = newRowState(r).Fields
+		paths[r.e.Name] = r.e.After.Path
+		codes[r.e.Name] = r.After.Code
+	}
+
+	// the second scenario isn't selected by Rows
+	assert.Equal(t, map[string][]string{
+		"users#create": nil,
+		"users#get":    nil,
+		"users#delete": nil,
+	}, got)
+	assert.Equal(t, after.URL+"/users/1000000", paths["users#get"])
+	assert.Equal(t, "204 No Content", codes["users#delete"])
+}
@@ -0,0 +1,359 @@
+package diff
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"mime"
+	"net/url"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+type (
+	// openAPIValidator validates responses against the operations of a spec
+	openAPIValidator struct {
+		spec   *openAPI
+		routes []openAPIRoute
+	}
+	openAPIRoute struct {
+		template string
+		re       *regexp.Regexp
+		item     openAPIPathItem
+	}
+	schemaError struct {
+		Path    string
+		Message string
+	}
+)
+
+var pathParam = regexp.MustCompile(`{[^/{}]+}`)
+
+func newOpenAPIValidator(spec *openAPI) *openAPIValidator {
+	v := &openAPIValidator{spec: spec}
+	for _, template := range spec.sortedPaths() {
+		v.routes = append(v.routes, openAPIRoute{
+			template: template,
+			re:       templateRegexp(template),
+			item:     spec.Paths[template],
+		})
+	}
+
+	// prefer the most specific template, i.e. /pets/mine over /pets/{id}
+	sort.SliceStable(v.routes, func(i, j int) bool {
+		return literalLen(v.routes[i].template) > literalLen(v.routes[j].template)
+	})
+	return v
+}
+
+// templateRegexp matches the paths of a path template. The path may have a
+// prefix such as the server's base path.
+func templateRegexp(template string) *regexp.Regexp {
+	expr := ""
+	last := 0
+	for _, loc := range pathParam.FindAllStringIndex(template, -1) {
+		expr += regexp.QuoteMeta(template[last:loc[0]]) + `[^/]+`
+		last = loc[1]
+	}
+	expr += regexp.QuoteMeta(template[last:])
+
+	return regexp.MustCompile(`^(?:/.*)?` + expr + `$`)
+}
+
+func literalLen(template string) int {
+	return len(pathParam.ReplaceAllString(template, ""))
+}
+
+// operation returns the operation that matches a request
+func (v *openAPIValidator) operation(method, rawURL string) (string, *openAPIOperation) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", nil
+	}
+
+	for _, r := range v.routes {
+		if !r.re.MatchString(u.Path) {
+			continue
+		}
+		if op, ok := r.item.operations()[strings.ToUpper(method)]; ok {
+			return r.template, op
+		}
+	}
+	return "", nil
+}
+
+// validateResult validates the outputs of every target of a result. Outputs
+// that failed to decode are validated too, the ones without a response are
+// skipped.
+func (v *openAPIValidator) validateResult(r result) []diff {
+	inputs := append([]input{r.e.Before, r.e.After}, r.e.Candidates...)
+	outputs := append([]output{r.Before, r.After}, r.Candidates...)
+	names := targetNames(len(inputs))
+
+	diffs := []diff{}
+	for i := range outputs {
+		if outputs[i].Code == "" {
+			continue
+		}
+		diffs = append(diffs, v.validate(names[i], inputs[i], outputs[i])...)
+	}
+	return diffs
+}
+
+// violatesUndecoded reports whether every output of a result that failed is
+// a response that couldn't be decoded and has contract violations of its own
+// in the diffs of the result
+func violatesUndecoded(r result) bool {
+	outputs := append([]output{r.Before, r.After}, r.Candidates...)
+	names := targetNames(len(outputs))
+	for i, o := range outputs {
+		if o.err == nil {
+			continue
+		}
+		if !isDecodeError(o.err) || o.Code == "" {
+			return false
+		}
+		prefix := "_schema." + names[i]
+		violated := false
+		for _, d := range r.Diffs {
+			if d.Field == prefix || strings.HasPrefix(d.Field, prefix+".") {
+				violated = true
+				break
+			}
+		}
+		if !violated {
+			return false
+		}
+	}
+	return true
+}
+
+// validate returns the contract violations of an output as diffs prefixed
+// with "_schema.<target>", i.e. _schema.after.items[0].price
+func (v *openAPIValidator) validate(target string, i input, o output) []diff {
+	template, op := v.operation(i.Method, i.Path)
+	if op == nil {
+		log.Debugf("openapi: no operation matches %s %s", i.Method, i.Path)
+		return nil
+	}
+
+	prefix := "_schema." + target
+	status := strings.SplitN(o.Code, " ", 2)[0]
+	res := v.spec.response(op.Responses[status])
+	if res == nil && len(status) == 3 {
+		res = v.spec.response(op.Responses[status[:1]+"XX"])
+	}
+	if res == nil {
+		res = v.spec.response(op.Responses["default"])
+	}
+	if res == nil {
+		return []diff{{
+			Field: prefix + ".status",
+			Delta: fmt.Sprintf("status %s is not documented for %s %s", o.Code, i.Method, template),
+		}}
+	}
+
+	if len(res.Content) == 0 {
+		return nil
+	}
+	mediaType, _, _ := mime.ParseMediaType(o.ContentType)
+	content, ok := matchMediaType(res.Content, mediaType)
+	if !ok {
+		return []diff{{
+			Field: prefix + ".contentType",
+			Delta: fmt.Sprintf("content type %q is not documented for %s %s %s", o.ContentType, i.Method, template, status),
+		}}
+	}
+	if content.Schema == nil || !strings.Contains(mediaType, "json") {
+		return nil
+	}
+
+	var body interface{}
+	if err := json.Unmarshal(o.Raw, &body); err != nil {
+		return []diff{{
+			Field: prefix,
+			Delta: "invalid json: " + err.Error(),
+		}}
+	}
+
+	diffs := []diff{}
+	for _, e := range v.spec.validateSchema(content.Schema, body, "") {
+		field := prefix
+		if e.Path != "" {
+			field += "." + e.Path
+		}
+		diffs = append(diffs, diff{
+			Field: field,
+			Delta: e.Message,
+		})
+	}
+	return diffs
+}
+
+// matchMediaType finds the documented content of a media type, including
+// wildcards such as application/* and */*
+func matchMediaType(content map[string]openAPIMediaType, mediaType string) (openAPIMediaType, bool) {
+	if c, ok := content[mediaType]; ok {
+		return c, true
+	}
+	if i := strings.Index(mediaType, "/"); i != -1 {
+		if c, ok := content[mediaType[:i]+"/*"]; ok {
+			return c, true
+		}
+	}
+	c, ok := content["*/*"]
+	return c, ok
+}
+
+// validateSchema validates a decoded JSON value against the subset of JSON
+// Schema that's used by OpenAPI: types, enums, required and additional
+// properties, items, nullable and the allOf, anyOf and oneOf combinators.
+func (s *openAPI) validateSchema(js *jsonSchema, v interface{}, path string) []schemaError {
+	js = s.schema(js)
+	if js == nil {
+		return nil
+	}
+
+	if v == nil {
+		if js.Nullable || js.Type == "" {
+			return nil
+		}
+		return []schemaError{{Path: path, Message: fmt.Sprintf("expected %s, got null", js.Type)}}
+	}
+
+	errs := []schemaError{}
+	for _, sub := range js.AllOf {
+		errs = append(errs, s.validateSchema(sub, v, path)...)
+	}
+	if len(js.AnyOf) > 0 && s.countValid(js.AnyOf, v, path) == 0 {
+		errs = append(errs, schemaError{Path: path, Message: "does not match any schema of anyOf"})
+	}
+	if len(js.OneOf) > 0 {
+		if n := s.countValid(js.OneOf, v, path); n != 1 {
+			errs = append(errs, schemaError{Path: path, Message: fmt.Sprintf("matches %d schemas of oneOf, expected 1", n)})
+		}
+	}
+
+	if js.Type != "" && !isType(js.Type, v) {
+		return append(errs, schemaError{Path: path, Message: fmt.Sprintf("expected %s, got %s", js.Type, jsonType(v))})
+	}
+
+	if len(js.Enum) > 0 {
+		found := false
+		for _, e := range js.Enum {
+			if reflect.DeepEqual(e, v) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			errs = append(errs, schemaError{Path: path, Message: fmt.Sprintf("%v is not one of %v", v, js.Enum)})
+		}
+	}
+
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for _, k := range js.Required {
+			if _, ok := v[k]; !ok {
+				errs = append(errs, schemaError{Path: joinPath(path, k), Message: "required property is missing"})
+			}
+		}
+
+		additional, allowed := s.additionalProperties(js)
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			if prop, ok := js.Properties[k]; ok {
+				errs = append(errs, s.validateSchema(prop, v[k], joinPath(path, k))...)
+			} else if !allowed {
+				errs = append(errs, schemaError{Path: joinPath(path, k), Message: "additional property is not allowed"})
+			} else if additional != nil {
+				errs = append(errs, s.validateSchema(additional, v[k], joinPath(path, k))...)
+			}
+		}
+
+	case []interface{}:
+		if js.Items != nil {
+			for i, item := range v {
+				errs = append(errs, s.validateSchema(js.Items, item, path+"["+strconv.Itoa(i)+"]")...)
+			}
+		}
+	}
+
+	return errs
+}
+
+func (s *openAPI) countValid(schemas []*jsonSchema, v interface{}, path string) int {
+	n := 0
+	for _, sub := range schemas {
+		if len(s.validateSchema(sub, v, path)) == 0 {
+			n++
+		}
+	}
+	return n
+}
+
+// additionalProperties returns the schema of additional properties and
+// whether they're allowed at all
+func (s *openAPI) additionalProperties(js *jsonSchema) (*jsonSchema, bool) {
+	raw := js.AdditionalProperties
+	if len(raw) == 0 || string(raw) == "true" {
+		return nil, true
+	}
+	if string(raw) == "false" {
+		return nil, false
+	}
+
+	var sub jsonSchema
+	if err := json.Unmarshal(raw, &sub); err != nil {
+		return nil, true
+	}
+	return &sub, true
+}
+
+func isType(typ string, v interface{}) bool {
+	switch typ {
+	case "integer":
+		n, ok := v.(float64)
+		return ok && n == math.Trunc(n)
+	case "number":
+		_, ok := v.(float64)
+		return ok
+	default:
+		return jsonType(v) == typ
+	}
+}
+
+func jsonType(v interface{}) string {
+	switch v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case float64:
+		return "number"
+	case string:
+		return "string"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	default:
+		return fmt.Sprintf("%T", v)
+	}
+}
+
+func joinPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
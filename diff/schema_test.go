@@ -0,0 +1,182 @@
+package diff
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/arithran/jsondiff"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_openAPIValidator_validate(t *testing.T) {
+	spec, err := loadOpenAPI("./testdata/openapi.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	v := newOpenAPIValidator(spec)
+
+	tests := []struct {
+		name string
+		i    input
+		o    output
+		want []diff
+	}{
+		{
+			name: "valid response",
+			i:    input{Method: "GET", Path: "http://after.api.com/v1/pets?status=sold"},
+			o: output{
+				Code:        "200 OK",
+				ContentType: "application/json; charset=utf-8",
+				Raw:         []byte(`{"items": [{"id": 1, "name": "Tom", "price": null, "tag": "cat"}]}`),
+			},
+			want: []diff{},
+		},
+		{
+			name: "invalid items",
+			i:    input{Method: "GET", Path: "http://after.api.com/v1/pets"},
+			o: output{
+				Code:        "200 OK",
+				ContentType: "application/json",
+				Raw:         []byte(`{"items": [{"id": 1.5, "price": "12", "tag": "bird"}]}`),
+			},
+			want: []diff{
+				{Field: "_schema.after.items[0].name", Delta: "required property is missing"},
+				{Field: "_schema.after.items[0].id", Delta: "expected integer, got number"},
+				{Field: "_schema.after.items[0].price", Delta: "expected number, got string"},
+				{Field: "_schema.after.items[0].tag", Delta: "bird is not one of [cat dog]"},
+			},
+		},
+		{
+			name: "default response",
+			i:    input{Method: "GET", Path: "http://after.api.com/v1/pets/1"},
+			o: output{
+				Code:        "404 Not Found",
+				ContentType: "application/json",
+				Raw:         []byte(`{"error": "not found"}`),
+			},
+			want: []diff{
+				{Field: "_schema.after.message", Delta: "required property is missing"},
+			},
+		},
+		{
+			name: "undocumented status",
+			i:    input{Method: "GET", Path: "http://after.api.com/v1/stores/1/orders/2"},
+			o:    output{Code: "500 Internal Server Error"},
+			want: []diff{
+				{Field: "_schema.after.status", Delta: "status 500 Internal Server Error is not documented for GET /stores/{storeId}/orders/{orderId}"},
+			},
+		},
+		{
+			name: "undocumented content type",
+			i:    input{Method: "GET", Path: "http://after.api.com/v1/pets"},
+			o:    output{Code: "200 OK", ContentType: "text/html"},
+			want: []diff{
+				{Field: "_schema.after.contentType", Delta: `content type "text/html" is not documented for GET /pets 200`},
+			},
+		},
+		{
+			name: "undocumented operation",
+			i:    input{Method: "GET", Path: "http://after.api.com/v1/users"},
+			o:    output{Code: "200 OK"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, v.validate("after", tt.i, tt.o))
+		})
+	}
+}
+
+func Test_openAPIValidator_compare(t *testing.T) {
+	spec, err := loadOpenAPI("./testdata/openapi.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	v := newOpenAPIValidator(spec)
+
+	newServer := func(contentType, body string) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", contentType)
+			fmt.Fprint(w, body)
+		}))
+	}
+	jsonSrv := newServer("application/json", `{"items": []}`)
+	defer jsonSrv.Close()
+	htmlSrv := newServer("text/html", "<html>Bad Gateway</html>")
+	defer htmlSrv.Close()
+	closedSrv := newServer("application/json", "{}")
+	closedSrv.Close()
+
+	tests := []struct {
+		name       string
+		path       string
+		before     string
+		after      string
+		wantErr    bool
+		wantFields []string
+	}{
+		{
+			name:   "valid",
+			path:   "/v1/pets",
+			before: jsonSrv.URL,
+			after:  jsonSrv.URL,
+		},
+		{
+			name:       "undocumented content type that can't be decoded",
+			path:       "/v1/pets",
+			before:     jsonSrv.URL,
+			after:      htmlSrv.URL,
+			wantFields: []string{"_schema.after.contentType"},
+		},
+		{
+			name:       "before can't be decoded",
+			path:       "/v1/pets",
+			before:     htmlSrv.URL,
+			after:      jsonSrv.URL,
+			wantFields: []string{"_schema.before.contentType"},
+		},
+		{
+			name:       "after is unreachable",
+			path:       "/v1/pets",
+			before:     htmlSrv.URL,
+			after:      closedSrv.URL,
+			wantErr:    true,
+			wantFields: []string{"_schema.before.contentType"},
+		},
+		{
+			name:    "operation that isn't documented",
+			path:    "/v1/users",
+			before:  htmlSrv.URL,
+			after:   htmlSrv.URL,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := Config{BeforeBasePath: tt.before, AfterBasePath: tt.after}
+			targets, err := newTargets(c)
+			if err != nil {
+				t.Fatal(err)
+			}
+			tests := make(chan test, 1)
+			tests <- test{
+				Row:    1,
+				Before: input{Method: "GET", Path: tt.before + tt.path},
+				After:  input{Method: "GET", Path: tt.after + tt.path},
+			}
+			close(tests)
+
+			for r := range compare(context.Background(), targets, tests, nil, jsondiff.FullMatch, nil, v, nil) {
+				assert.Equal(t, tt.wantErr, r.err != nil)
+				fields := []string(nil)
+				for _, d := range r.Diffs {
+					fields = append(fields, d.Field)
+				}
+				assert.Equal(t, tt.wantFields, fields)
+			}
+		})
+	}
+}
@@ -0,0 +1,148 @@
+package diff
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// ServeConfig configures the mock server of Serve
+type ServeConfig struct {
+	Listen      string // i.e. :8081
+	SnapshotDir string
+	Fallback    string       // a status code or the base path of a target for unknown requests, default: 404
+	Target      TargetConfig // of the fallback target
+	LogLevel    string
+}
+
+// snapshotServer serves the recorded responses of a snapshot directory
+type snapshotServer struct {
+	snapshots map[string]snapshot
+	status    int     // of unknown requests
+	fallback  *target // sends unknown requests to a target instead
+}
+
+// Serve serves the snapshots of a directory until the context is canceled
+func Serve(ctx context.Context, c ServeConfig) error {
+	if c.LogLevel != "" {
+		if err := setLoglevel(c.LogLevel); err != nil {
+			return err
+		}
+	}
+
+	s, err := newSnapshotServer(c)
+	if err != nil {
+		return err
+	}
+
+	srv := &http.Server{Addr: c.Listen, Handler: s}
+	errs := make(chan error, 1)
+	go func() {
+		errs <- srv.ListenAndServe()
+	}()
+	log.Infof("serving %d snapshots of %s on %s", len(s.snapshots), c.SnapshotDir, c.Listen)
+
+	select {
+	case err = <-errs:
+	case <-ctx.Done():
+		sctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		err = srv.Shutdown(sctx)
+		cancel()
+	}
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+	return err
+}
+
+func newSnapshotServer(c ServeConfig) (*snapshotServer, error) {
+	snapshots, err := loadSnapshots(c.SnapshotDir)
+	if err != nil {
+		return nil, fmt.Errorf("snapshots: %w", err)
+	}
+	s := &snapshotServer{
+		snapshots: snapshots,
+		status:    http.StatusNotFound,
+	}
+
+	if c.Fallback == "" {
+		return s, nil
+	}
+	if status, err := strconv.Atoi(c.Fallback); err == nil {
+		if status < 100 || status > 599 {
+			return nil, fmt.Errorf("fallback: invalid status code %d", status)
+		}
+		s.status = status
+		return s, nil
+	}
+
+	u, err := url.Parse(c.Fallback)
+	if !strings.HasPrefix(c.Fallback, unixScheme) && (err != nil || (u.Scheme != "http" && u.Scheme != "https")) {
+		return nil, fmt.Errorf("fallback: expected a status code or a url, got %q", c.Fallback)
+	}
+	tc := Config{
+		BeforeBasePath: c.Fallback,
+		Targets:        map[string]TargetConfig{"before": c.Target},
+	}.withUnixSockets()
+	s.fallback, err = newTarget(tc, "before", tc.BeforeBasePath)
+	if err != nil {
+		return nil, fmt.Errorf("fallback: %w", err)
+	}
+	s.fallback.returnRedirects()
+	return s, nil
+}
+
+// ServeHTTP returns the snapshot of a request, or the fallback when there's
+// none
+func (s *snapshotServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	snap, ok := s.snapshots[snapshotKey(r.Method, r.URL.Path, r.URL.RawQuery, snapshotBodyHash(body))]
+	if ok {
+		log.Debugf("serve: %s %s", r.Method, r.URL.RequestURI())
+		for k, vs := range snap.Headers {
+			for _, v := range vs {
+				w.Header().Add(k, v)
+			}
+		}
+		if len(snap.Body) > 0 && w.Header().Get("Content-Type") == "" {
+			w.Header().Set("Content-Type", "application/json")
+		}
+		w.WriteHeader(snap.Status)
+		_, _ = w.Write(snap.body())
+		return
+	}
+
+	log.Infof("serve: no snapshot for %s %s", r.Method, r.URL.RequestURI())
+	if s.fallback != nil {
+		i := input{
+			Method:  r.Method,
+			Path:    s.fallback.base + r.URL.RequestURI(),
+			Headers: proxyHeaders(r),
+			Body:    string(body),
+		}
+		if _, _, err := pass(w, r, s.fallback, i); err != nil {
+			log.Errorf("serve: %s %s err:%v", r.Method, r.URL.RequestURI(), err)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(s.status)
+	_ = json.NewEncoder(w).Encode(map[string]string{
+		"error": fmt.Sprintf("no snapshot for %s %s", r.Method, r.URL.RequestURI()),
+	})
+}
@@ -0,0 +1,215 @@
+package diff
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_snapshotServer(t *testing.T) {
+	dir, err := ioutil.TempDir("", "apicmp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	api := newProxiedServer("john")
+	defer api.Close()
+	upstream := newProxiedServer("jane")
+	defer upstream.Close()
+
+	sockets, err := ioutil.TempDir("", "apicmp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(sockets)
+	socket := filepath.Join(sockets, "api.sock")
+	l, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	unix := &http.Server{Handler: upstream.Config.Handler}
+	go unix.Serve(l)
+	defer unix.Close()
+
+	// record
+	cp, err := newCapture(Config{BeforeBasePath: api.URL}, &bytes.Buffer{}, CaptureConfig{SnapshotDir: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	recorder := httptest.NewServer(cp)
+	for _, r := range []struct{ method, path, body string }{
+		{http.MethodGet, "/users/1?fields=name&lang=en", ""},
+		{http.MethodPost, "/users", `{"name":"joe","age":7}`},
+		{http.MethodGet, "/", ""},
+	} {
+		req, _ := http.NewRequest(r.method, recorder.URL+r.path, strings.NewReader(r.body))
+		resp, err := recorder.Client().Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+	}
+	recorder.Close()
+
+	// request bodies are only recorded as a hash
+	recorded, err := loadSnapshots(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hashed := 0
+	for _, s := range recorded {
+		assert.Empty(t, s.RequestBody)
+		if s.RequestHash != "" {
+			hashed++
+		}
+	}
+	assert.Equal(t, 1, hashed)
+
+	// a hand written snapshot
+	err = ioutil.WriteFile(filepath.Join(dir, "stub.json"), []byte(`{"path": "/stub", "body": {"ok": true}}`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ioutil.WriteFile(filepath.Join(dir, "login.json"), []byte(`{"method": "POST", "path": "/login", "request_body": "{\"user\": \"joe\"}", "body": {"token": "abc"}}`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		fallback string
+		method   string
+		path     string
+		body     string
+		wantCode int
+		wantBody string
+		wantType string
+	}{
+		{
+			name:     "query params in any order",
+			method:   http.MethodGet,
+			path:     "/users/1?lang=en&fields=name",
+			wantCode: http.StatusOK,
+			wantBody: `{"id":1,"name":"john"}`,
+			wantType: "application/json",
+		},
+		{
+			name:     "json bodies in any format",
+			method:   http.MethodPost,
+			path:     "/users",
+			body:     `{"age": 7, "name": "joe"}`,
+			wantCode: http.StatusCreated,
+			wantBody: `{"name":"joe","age":7}`,
+			wantType: "application/json",
+		},
+		{
+			name:     "other bodies",
+			method:   http.MethodGet,
+			path:     "/",
+			wantCode: http.StatusOK,
+			wantBody: "<html>john</html>",
+			wantType: "text/html",
+		},
+		{
+			name:     "hand written",
+			method:   http.MethodGet,
+			path:     "/stub",
+			wantCode: http.StatusOK,
+			wantBody: `{"ok":true}`,
+			wantType: "application/json",
+		},
+		{
+			name:     "hand written with a request body",
+			method:   http.MethodPost,
+			path:     "/login",
+			body:     `{"user":"joe"}`,
+			wantCode: http.StatusOK,
+			wantBody: `{"token":"abc"}`,
+			wantType: "application/json",
+		},
+		{
+			name:     "unknown",
+			method:   http.MethodPost,
+			path:     "/users",
+			body:     `{"name":"jim"}`,
+			wantCode: http.StatusNotFound,
+			wantBody: `{"error":"no snapshot for POST /users"}` + "\n",
+			wantType: "application/json",
+		},
+		{
+			name:     "unknown with a fallback status",
+			fallback: "503",
+			method:   http.MethodGet,
+			path:     "/users/2",
+			wantCode: http.StatusServiceUnavailable,
+			wantBody: `{"error":"no snapshot for GET /users/2"}` + "\n",
+			wantType: "application/json",
+		},
+		{
+			name:     "unknown with a fallback target",
+			fallback: upstream.URL,
+			method:   http.MethodGet,
+			path:     "/users/1",
+			wantCode: http.StatusOK,
+			wantBody: `{"id":1,"name":"jane"}` + "\n",
+			wantType: "application/json",
+		},
+		{
+			name:     "unknown with a fallback unix socket",
+			fallback: "unix://" + socket,
+			method:   http.MethodGet,
+			path:     "/users/1",
+			wantCode: http.StatusOK,
+			wantBody: `{"id":1,"name":"jane"}` + "\n",
+			wantType: "application/json",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := newSnapshotServer(ServeConfig{SnapshotDir: dir, Fallback: tt.fallback})
+			if err != nil {
+				t.Fatal(err)
+			}
+			srv := httptest.NewServer(s)
+			defer srv.Close()
+
+			req, _ := http.NewRequest(tt.method, srv.URL+tt.path, strings.NewReader(tt.body))
+			resp, err := srv.Client().Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+			body, _ := ioutil.ReadAll(resp.Body)
+
+			assert.Equal(t, tt.wantCode, resp.StatusCode)
+			assert.Equal(t, tt.wantBody, string(body))
+			if tt.wantType != "" {
+				assert.Contains(t, resp.Header.Get("Content-Type"), tt.wantType)
+			}
+		})
+	}
+}
+
+func Test_newSnapshotServerFallback(t *testing.T) {
+	dir, err := ioutil.TempDir("", "apicmp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	for _, fallback := range []string{"42", "localhost:8080", "ftp://example.com"} {
+		_, err := newSnapshotServer(ServeConfig{SnapshotDir: dir, Fallback: fallback})
+		assert.Error(t, err, fallback)
+	}
+	_, err = newSnapshotServer(ServeConfig{SnapshotDir: filepath.Join(dir, "missing")})
+	assert.Error(t, err)
+}
@@ -0,0 +1,331 @@
+package diff
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// Signing types supported by signing config files
+const (
+	SignHMAC  = "hmac"
+	SignSigV4 = "sigv4"
+)
+
+const (
+	defaultCanonical = "{{.Method}}\n{{.URI}}\n{{.Timestamp}}\n{{.BodySHA256}}"
+	amzDateFormat    = "20060102T150405Z"
+)
+
+type (
+	// signConfig is the signing config file of a target, i.e.
+	//
+	//	type: sigv4
+	//	region: us-east-1
+	//	service: execute-api
+	//
+	// ${ENV} variables are expanded.
+	signConfig struct {
+		Type string `json:"type"`
+
+		// hmac
+		Secret          string `json:"secret"`
+		Header          string `json:"header"`           // default: X-Signature
+		Prefix          string `json:"prefix"`           // i.e. "HMAC-SHA256 "
+		Canonical       string `json:"canonical"`        // template of the signed string
+		TimestampHeader string `json:"timestamp_header"` // default: X-Timestamp, "-" to omit
+		Encoding        string `json:"encoding"`         // hex (default) or base64
+
+		// sigv4, the credentials default to the AWS_* environment variables
+		Region          string `json:"region"`
+		Service         string `json:"service"`
+		AccessKeyID     string `json:"access_key_id"`
+		SecretAccessKey string `json:"secret_access_key"`
+		SessionToken    string `json:"session_token"`
+	}
+
+	// signer signs a request after all of its headers are set
+	signer interface {
+		sign(req *http.Request, body []byte, now time.Time) error
+	}
+
+	hmacSigner struct {
+		secret          []byte
+		header          string
+		prefix          string
+		canonical       *template.Template
+		timestampHeader string
+		encoding        string
+	}
+	// canonicalRequest is the data of the canonical string template
+	canonicalRequest struct {
+		Method     string
+		Host       string
+		Path       string
+		Query      string
+		URI        string // path and query
+		Body       string
+		BodySHA256 string
+		Timestamp  string // unix seconds
+
+		req *http.Request
+	}
+
+	sigV4Signer struct {
+		region          string
+		service         string
+		accessKeyID     string
+		secretAccessKey string
+		sessionToken    string
+	}
+)
+
+func newSigner(path string) (signer, error) {
+	var c signConfig
+	if err := readYAMLFile(path, &c); err != nil {
+		return nil, err
+	}
+
+	switch c.Type {
+	case SignHMAC:
+		s := &hmacSigner{
+			secret:          []byte(os.ExpandEnv(c.Secret)),
+			header:          "X-Signature",
+			prefix:          c.Prefix,
+			timestampHeader: "X-Timestamp",
+			encoding:        "hex",
+		}
+		if len(s.secret) == 0 {
+			return nil, errors.New("secret is required")
+		}
+		if c.Header != "" {
+			s.header = c.Header
+		}
+		if c.TimestampHeader != "" {
+			s.timestampHeader = c.TimestampHeader
+		}
+		if c.Encoding != "" {
+			s.encoding = c.Encoding
+		}
+		if s.encoding != "hex" && s.encoding != "base64" {
+			return nil, fmt.Errorf("unsupported encoding %q", s.encoding)
+		}
+
+		canonical := c.Canonical
+		if canonical == "" {
+			canonical = defaultCanonical
+		}
+		var err error
+		s.canonical, err = template.New("canonical").Funcs(template.FuncMap{
+			"header": func(r canonicalRequest, name string) string { return r.req.Header.Get(name) },
+		}).Parse(canonical)
+		if err != nil {
+			return nil, fmt.Errorf("canonical: %w", err)
+		}
+		return s, nil
+
+	case SignSigV4:
+		s := &sigV4Signer{
+			region:          os.ExpandEnv(c.Region),
+			service:         os.ExpandEnv(c.Service),
+			accessKeyID:     envOr(c.AccessKeyID, "AWS_ACCESS_KEY_ID"),
+			secretAccessKey: envOr(c.SecretAccessKey, "AWS_SECRET_ACCESS_KEY"),
+			sessionToken:    envOr(c.SessionToken, "AWS_SESSION_TOKEN"),
+		}
+		if s.region == "" {
+			s.region = os.Getenv("AWS_REGION")
+		}
+		if s.region == "" || s.service == "" {
+			return nil, errors.New("region and service are required")
+		}
+		if s.accessKeyID == "" || s.secretAccessKey == "" {
+			return nil, errors.New("access_key_id and secret_access_key are required")
+		}
+		return s, nil
+
+	default:
+		return nil, fmt.Errorf("unsupported signing type %q", c.Type)
+	}
+}
+
+// envOr expands a config value, or returns the environment variable when empty
+func envOr(v, env string) string {
+	if v == "" {
+		return os.Getenv(env)
+	}
+	return os.ExpandEnv(v)
+}
+
+// sign sets the timestamp header and the HMAC-SHA256 of the canonical string.
+// Request headers are available to the canonical string with the header func,
+// i.e. {{header . "X-Api-Key"}}.
+func (s *hmacSigner) sign(req *http.Request, body []byte, now time.Time) error {
+	ts := strconv.FormatInt(now.Unix(), 10)
+	if s.timestampHeader != "-" {
+		req.Header.Set(s.timestampHeader, ts)
+	}
+
+	sum := sha256.Sum256(body)
+	data := canonicalRequest{
+		Method:     req.Method,
+		Host:       req.URL.Host,
+		Path:       req.URL.EscapedPath(),
+		Query:      req.URL.RawQuery,
+		URI:        req.URL.RequestURI(),
+		Body:       string(body),
+		BodySHA256: hex.EncodeToString(sum[:]),
+		Timestamp:  ts,
+		req:        req,
+	}
+
+	var buf bytes.Buffer
+	if err := s.canonical.Execute(&buf, data); err != nil {
+		return fmt.Errorf("canonical: %w", err)
+	}
+
+	mac := hmac.New(sha256.New, s.secret)
+	mac.Write(buf.Bytes())
+	signature := hex.EncodeToString(mac.Sum(nil))
+	if s.encoding == "base64" {
+		signature = base64.StdEncoding.EncodeToString(mac.Sum(nil))
+	}
+	req.Header.Set(s.header, s.prefix+signature)
+	return nil
+}
+
+// sign signs a request with AWS Signature Version 4. The host, content type
+// and x-amz-* headers are signed.
+func (s *sigV4Signer) sign(req *http.Request, body []byte, now time.Time) error {
+	now = now.UTC()
+	amzDate := now.Format(amzDateFormat)
+	date := now.Format("20060102")
+
+	req.Header.Set("X-Amz-Date", amzDate)
+	if s.sessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", s.sessionToken)
+	}
+
+	host := req.Host
+	if host == "" {
+		host = req.URL.Host
+	}
+	headers := map[string]string{"host": host}
+	for k, vs := range req.Header {
+		k = strings.ToLower(k)
+		if k == "content-type" || strings.HasPrefix(k, "x-amz-") {
+			headers[k] = canonicalHeaderValue(vs)
+		}
+	}
+	names := make([]string, 0, len(headers))
+	for k := range headers {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+
+	var canonicalHeaders strings.Builder
+	for _, k := range names {
+		canonicalHeaders.WriteString(k + ":" + headers[k] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	payload := sha256.Sum256(body)
+	canonical := strings.Join([]string{
+		req.Method,
+		sigV4Path(req.URL),
+		sigV4Query(req.URL),
+		canonicalHeaders.String(),
+		signedHeaders,
+		hex.EncodeToString(payload[:]),
+	}, "\n")
+
+	scope := date + "/" + s.region + "/" + s.service + "/aws4_request"
+	hash := sha256.Sum256([]byte(canonical))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(hash[:])
+
+	key := hmacSHA256([]byte("AWS4"+s.secretAccessKey), date)
+	key = hmacSHA256(key, s.region)
+	key = hmacSHA256(key, s.service)
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s.accessKeyID, scope, signedHeaders, signature))
+	return nil
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// canonicalHeaderValue trims and joins header values, and collapses spaces
+func canonicalHeaderValue(vs []string) string {
+	out := make([]string, len(vs))
+	for i, v := range vs {
+		out[i] = strings.Join(strings.Fields(v), " ")
+	}
+	return strings.Join(out, ",")
+}
+
+// sigV4Path encodes every path segment once more, as required by every
+// service but S3
+func sigV4Path(u *url.URL) string {
+	path := u.EscapedPath()
+	if path == "" {
+		return "/"
+	}
+
+	segments := strings.Split(path, "/")
+	for i, s := range segments {
+		segments[i] = sigV4Escape(s)
+	}
+	return strings.Join(segments, "/")
+}
+
+// sigV4Query sorts the query by key and value and encodes it as per RFC 3986
+func sigV4Query(u *url.URL) string {
+	q := u.Query()
+	keys := make([]string, 0, len(q))
+	for k := range q {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	pairs := []string{}
+	for _, k := range keys {
+		vs := append([]string{}, q[k]...)
+		sort.Strings(vs)
+		for _, v := range vs {
+			pairs = append(pairs, sigV4Escape(k)+"="+sigV4Escape(v))
+		}
+	}
+	return strings.Join(pairs, "&")
+}
+
+// sigV4Escape escapes everything but the unreserved characters of RFC 3986
+func sigV4Escape(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if 'A' <= c && c <= 'Z' || 'a' <= c && c <= 'z' || '0' <= c && c <= '9' ||
+			c == '-' || c == '_' || c == '.' || c == '~' {
+			b.WriteByte(c)
+			continue
+		}
+		fmt.Fprintf(&b, "%%%02X", c)
+	}
+	return b.String()
+}
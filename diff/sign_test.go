@@ -0,0 +1,85 @@
+package diff
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"text/template"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_hmacSigner(t *testing.T) {
+	header := template.FuncMap{
+		"header": func(r canonicalRequest, name string) string { return r.req.Header.Get(name) },
+	}
+
+	tests := []struct {
+		name      string
+		s         *hmacSigner
+		want      map[string]string
+		canonical string
+	}{
+		{
+			name:      "default canonical string",
+			s:         &hmacSigner{header: "X-Signature", timestampHeader: "X-Timestamp", encoding: "hex"},
+			canonical: defaultCanonical,
+			want: map[string]string{
+				"X-Timestamp": "1440938160",
+				"X-Signature": "5c2b474d594a00458f500e2491f95750627a2060a45da18b8c22bbf7a61cf748",
+			},
+		},
+		{
+			name:      "custom canonical string",
+			s:         &hmacSigner{header: "Authorization", prefix: "HMAC ", timestampHeader: "-", encoding: "base64"},
+			canonical: `{{.Method}} {{.Path}} {{header . "X-Api-Key"}}`,
+			want: map[string]string{
+				"X-Timestamp":   "",
+				"Authorization": "HMAC XtfsHjx843yiUGWjdYTBuj8usq6MYCWv5tQT5Bs6dVA=",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.s.secret = []byte("secret")
+			tt.s.canonical = template.Must(template.New("canonical").Funcs(header).Parse(tt.canonical))
+
+			body := `{"a":1}`
+			req, _ := http.NewRequest("POST", "http://after.api.com/v1/pets?limit=10", strings.NewReader(body))
+			req.Header.Set("X-Api-Key", "abcd")
+
+			err := tt.s.sign(req, []byte(body), time.Unix(1440938160, 0))
+			assert.NoError(t, err)
+			for k, v := range tt.want {
+				assert.Equal(t, v, req.Header.Get(k), k)
+			}
+		})
+	}
+}
+
+// Test_sigV4Signer uses the get-vanilla case of the AWS SigV4 test suite
+func Test_sigV4Signer(t *testing.T) {
+	s := &sigV4Signer{
+		region:          "us-east-1",
+		service:         "service",
+		accessKeyID:     "AKIDEXAMPLE",
+		secretAccessKey: "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY",
+	}
+
+	req, _ := http.NewRequest("GET", "https://example.amazonaws.com/", nil)
+	now, _ := time.Parse(amzDateFormat, "20150830T123600Z")
+	err := s.sign(req, nil, now)
+	assert.NoError(t, err)
+
+	assert.Equal(t, "20150830T123600Z", req.Header.Get("X-Amz-Date"))
+	assert.Equal(t, "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/service/aws4_request, "+
+		"SignedHeaders=host;x-amz-date, "+
+		"Signature=5fa00fa31553b73ebf1942676e86291e8372ff2a2260956d9b8aae1d763fbf31", req.Header.Get("Authorization"))
+}
+
+func Test_sigV4Query(t *testing.T) {
+	req, _ := http.NewRequest("GET", "https://example.amazonaws.com/a%20b/c?Param2=value2&Param1=value%201&Param1=a", nil)
+	assert.Equal(t, "/a%2520b/c", sigV4Path(req.URL))
+	assert.Equal(t, "Param1=a&Param1=value%201&Param2=value2", sigV4Query(req.URL))
+}
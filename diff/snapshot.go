@@ -0,0 +1,169 @@
+package diff
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// snapshotSkipHeaders are set again when a snapshot is served
+var snapshotSkipHeaders = map[string]struct{}{
+	"Content-Length": {},
+	"Date":           {},
+	"Set-Cookie":     {},
+}
+
+// unsafeFileChars are replaced in the file names of snapshots
+var unsafeFileChars = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// snapshot is a recorded response, i.e.
+//
+//	{"method": "GET", "path": "/users/1", "query": "fields=name", "status": 200, "headers": {"Content-Type": ["application/json"]}, "body": {"id": 1}}
+//
+// Snapshots are matched by method, path, query and request body. The query
+// is matched regardless of the order of its params, and JSON bodies
+// regardless of their formatting. Recorded request bodies are only stored as
+// a hash, since they may contain credentials. Hand written snapshots can
+// give the request body instead.
+type snapshot struct {
+	Method      string              `json:"method"`
+	Path        string              `json:"path"`
+	Query       string              `json:"query,omitempty"`
+	RequestBody string              `json:"request_body,omitempty"`
+	RequestHash string              `json:"request_body_sha256,omitempty"` // see snapshotBodyHash
+	Status      int                 `json:"status"`
+	Headers     map[string][]string `json:"headers,omitempty"`
+	Body        json.RawMessage     `json:"body,omitempty"` // a JSON response body
+	Text        string              `json:"text,omitempty"` // any other response body
+}
+
+// newSnapshot returns the snapshot of a response
+func newSnapshot(r *http.Request, reqBody []byte, resp *http.Response, body []byte) snapshot {
+	s := snapshot{
+		Method:  r.Method,
+		Path:    r.URL.Path,
+		Query:   r.URL.RawQuery,
+		Status:  resp.StatusCode,
+		Headers: map[string][]string{},
+	}
+	for k, vs := range resp.Header {
+		if _, ok := snapshotSkipHeaders[k]; ok || isHopHeader(k) {
+			continue
+		}
+		s.Headers[k] = vs
+	}
+	if len(reqBody) > 0 {
+		s.RequestHash = snapshotBodyHash(reqBody)
+	}
+	if json.Valid(body) {
+		s.Body = body
+	} else {
+		s.Text = string(body)
+	}
+	return s
+}
+
+// body returns the response body. JSON bodies are compacted, since they're
+// indented in the snapshot file.
+func (s snapshot) body() []byte {
+	if len(s.Body) == 0 {
+		return []byte(s.Text)
+	}
+	var buf bytes.Buffer
+	if err := json.Compact(&buf, s.Body); err != nil {
+		return s.Body
+	}
+	return buf.Bytes()
+}
+
+// key returns the hash of the method, path, query and request body
+func (s snapshot) key() string {
+	bodyHash := s.RequestHash
+	if s.RequestBody != "" {
+		bodyHash = snapshotBodyHash([]byte(s.RequestBody))
+	}
+	return snapshotKey(s.Method, s.Path, s.Query, bodyHash)
+}
+
+func snapshotKey(method, path, query, bodyHash string) string {
+	// sorted by key
+	if q, err := url.ParseQuery(query); err == nil {
+		query = q.Encode()
+	}
+	if bodyHash == "" {
+		bodyHash = snapshotBodyHash(nil)
+	}
+
+	h := sha256.Sum256([]byte(strings.ToUpper(method) + "\n" + path + "\n" + query + "\n" + bodyHash))
+	return hex.EncodeToString(h[:])
+}
+
+// snapshotBodyHash returns the hash of a request body. JSON bodies are
+// compacted with sorted keys first.
+func snapshotBodyHash(body []byte) string {
+	var v interface{}
+	if err := json.Unmarshal(body, &v); err == nil {
+		body, _ = json.Marshal(v)
+	}
+	h := sha256.Sum256(body)
+	return hex.EncodeToString(h[:])
+}
+
+// write writes a snapshot to a file named after its method, path and key.
+// The snapshot of the same request is replaced.
+func (s snapshot) write(dir string) error {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(s); err != nil {
+		return err
+	}
+
+	name := strings.Trim(unsafeFileChars.ReplaceAllString(s.Path, "-"), "-")
+	if len(name) > 100 {
+		name = name[:100]
+	}
+	name = fmt.Sprintf("%s-%s-%s.json", s.Method, name, s.key()[:16])
+	return ioutil.WriteFile(filepath.Join(dir, name), buf.Bytes(), 0644)
+}
+
+// loadSnapshots reads the .json files of a directory by key
+func loadSnapshots(dir string) (map[string]snapshot, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	if _, err := os.Stat(dir); err != nil {
+		return nil, err
+	}
+
+	out := make(map[string]snapshot, len(files))
+	for _, path := range files {
+		raw, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		var s snapshot
+		if err := json.Unmarshal(raw, &s); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		if s.Method == "" {
+			s.Method = http.MethodGet
+		}
+		if s.Status == 0 {
+			s.Status = http.StatusOK
+		}
+		out[s.key()] = s
+	}
+	return out, nil
+}
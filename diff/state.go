@@ -0,0 +1,188 @@
+package diff
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// rowState is the outcome of a completed row. The state file holds one JSON
+// encoded rowState per line, so a run that's interrupted while writing only
+// loses the row that was being written.
+type rowState struct {
+	Row    int      `json:"row"`
+	Passed bool     `json:"passed"`
+	Fields []string `json:"fields,omitempty"`
+
+	// Accepted are the fields that differ but are accepted by the baseline
+	Accepted []string `json:"accepted,omitempty"`
+
+	// Protocols are the negotiated protocols by target, i.e. "after": "HTTP/2.0"
+	Protocols map[string]string `json:"protocols,omitempty"`
+}
+
+// stateRun is the first line of a state file, i.e.
+//
+//	{"run": {"file": "/tests/fixtures.csv", "before": "https://api.example.com", "after": "https://new-api.example.com"}}
+//
+// A state file is only resumed by a run of the same fixture file and targets.
+type stateRun struct {
+	File       string   `json:"file"`
+	Before     string   `json:"before"`
+	After      string   `json:"after"`
+	Candidates []string `json:"candidates,omitempty"`
+}
+
+// stateLine is a line of the state file, the run or a row
+type stateLine struct {
+	Run *stateRun `json:"run,omitempty"`
+	rowState
+}
+
+func newStateRun(c Config) stateRun {
+	file, err := filepath.Abs(c.FixtureFilePath)
+	if err != nil {
+		file = c.FixtureFilePath
+	}
+	return stateRun{
+		File:       file,
+		Before:     c.BeforeBasePath,
+		After:      c.AfterBasePath,
+		Candidates: c.CandidateBasePaths,
+	}
+}
+
+// match returns an error when the state file of r can't be resumed by the
+// run cur
+func (r *stateRun) match(cur stateRun) error {
+	if r == nil {
+		return errors.New("it doesn't record its fixture file and targets, run without --resume")
+	}
+	if r.File != cur.File {
+		return fmt.Errorf("it's a run of %s, not %s", r.File, cur.File)
+	}
+	if r.Before != cur.Before || r.After != cur.After || strings.Join(r.Candidates, ",") != strings.Join(cur.Candidates, ",") {
+		return fmt.Errorf("it's a run of the targets %s, not %s", r.targets(), cur.targets())
+	}
+	return nil
+}
+
+// targets returns the base paths of a run, i.e. "before,after"
+func (r stateRun) targets() string {
+	return strings.Join(append([]string{r.Before, r.After}, r.Candidates...), ",")
+}
+
+func newRowState(r result) rowState {
+	s := rowState{
+		Row:    r.e.Row,
+		Passed: len(r.Diffs) == 0,
+	}
+	for _, d := range r.Diffs {
+		s.Fields = append(s.Fields, d.Field)
+	}
+	for _, a := range r.Accepted {
+		s.Accepted = append(s.Accepted, a.Field)
+	}
+
+	outputs := append([]output{r.Before, r.After}, r.Candidates...)
+	names := targetNames(len(outputs))
+	for i, o := range outputs {
+		if o.Proto == "" {
+			continue
+		}
+		if s.Protocols == nil {
+			s.Protocols = make(map[string]string, len(outputs))
+		}
+		s.Protocols[names[i]] = o.Proto
+	}
+	return s
+}
+
+// loadState reads the run and the completed rows of a previous run. A
+// missing file is not an error, because the first run of --resume creates it.
+func loadState(path string) (*stateRun, map[int]rowState, error) {
+	states := map[int]rowState{}
+
+	f, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, states, nil
+		}
+		return nil, nil, err
+	}
+	defer f.Close()
+
+	var run *stateRun
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 10*1024*1024)
+	line := 0
+	for scanner.Scan() {
+		line++
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+
+		var s stateLine
+		if err := json.Unmarshal(scanner.Bytes(), &s); err != nil {
+			log.Warnf("state file %s: skipping invalid line #%d", path, line)
+			continue
+		}
+		if s.Run != nil {
+			run = s.Run
+			continue
+		}
+		states[s.Row] = s.rowState
+	}
+
+	return run, states, scanner.Err()
+}
+
+type stateWriter struct {
+	f   *os.File
+	enc *json.Encoder
+}
+
+// newStateWriter writes completed rows to the state file as they finish.
+// The file is truncated unless a previous run is being resumed, and a new
+// file starts with the run.
+func newStateWriter(path string, resume bool, run stateRun) (*stateWriter, error) {
+	flag := os.O_CREATE | os.O_WRONLY | os.O_TRUNC
+	if resume {
+		flag = os.O_CREATE | os.O_WRONLY | os.O_APPEND
+	}
+
+	f, err := os.OpenFile(path, flag, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	w := &stateWriter{
+		f:   f,
+		enc: json.NewEncoder(f),
+	}
+	fi, err := f.Stat()
+	if err == nil && fi.Size() == 0 {
+		err = w.enc.Encode(struct {
+			Run stateRun `json:"run"`
+		}{run})
+	}
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return w, nil
+}
+
+func (w *stateWriter) Write(s rowState) error {
+	return w.enc.Encode(s)
+}
+
+func (w *stateWriter) Close() error {
+	return w.f.Close()
+}
@@ -0,0 +1,103 @@
+package diff
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_state(t *testing.T) {
+	dir, err := ioutil.TempDir("", "apicmp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "state.json")
+
+	// a missing file is an empty state
+	run, got, err := loadState(path)
+	assert.NoError(t, err)
+	assert.Nil(t, run)
+	assert.Empty(t, got)
+
+	cur := stateRun{File: "/tests/get.csv", Before: "http://before.api.com", After: "http://after.api.com"}
+	w, err := newStateWriter(path, false, cur)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.NoError(t, w.Write(rowState{Row: 1, Passed: true}))
+	assert.NoError(t, w.Write(rowState{Row: 2, Fields: []string{"name"}}))
+	assert.NoError(t, w.Close())
+
+	// simulate a run that was killed in the middle of a write
+	w, err = newStateWriter(path, true, cur)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _ = w.f.WriteString(`{"row":3,"pas`)
+	assert.NoError(t, w.Close())
+
+	run, got, err = loadState(path)
+	assert.NoError(t, err)
+	assert.Equal(t, &cur, run)
+	assert.Equal(t, map[int]rowState{
+		1: {Row: 1, Passed: true},
+		2: {Row: 2, Fields: []string{"name"}},
+	}, got)
+	raw, _ := ioutil.ReadFile(path)
+	assert.Equal(t, 1, strings.Count(string(raw), `"run"`))
+}
+
+func Test_stateRunMatch(t *testing.T) {
+	cur := stateRun{File: "/tests/get.csv", Before: "http://before.api.com", After: "http://after.api.com"}
+	other := func(f func(r *stateRun)) *stateRun {
+		r := cur
+		f(&r)
+		return &r
+	}
+
+	assert.NoError(t, other(func(r *stateRun) {}).match(cur))
+	assert.EqualError(t, (*stateRun)(nil).match(cur), "it doesn't record its fixture file and targets, run without --resume")
+	assert.EqualError(t, other(func(r *stateRun) { r.File = "/tests/post.csv" }).match(cur),
+		"it's a run of /tests/post.csv, not /tests/get.csv")
+	assert.EqualError(t, other(func(r *stateRun) { r.After = "http://canary.api.com" }).match(cur),
+		"it's a run of the targets http://before.api.com,http://canary.api.com, not http://before.api.com,http://after.api.com")
+	assert.Error(t, other(func(r *stateRun) { r.Candidates = []string{"http://canary.api.com"} }).match(cur))
+}
+
+func Test_generateTestsSkipsCompleted(t *testing.T) {
+	testChan, err := generateTests(context.Background(), Config{
+		BeforeBasePath:  "http://before.api.com",
+		AfterBasePath:   "http://after.api.com",
+		FixtureFilePath: "./testdata/get.csv",
+		completed:       map[int]struct{}{1: {}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rows := []int{}
+	for t := range testChan {
+		rows = append(rows, t.Row)
+	}
+	assert.Equal(t, []int{2}, rows)
+}
+
+func Test_newRowState(t *testing.T) {
+	r := result{
+		e:      test{Row: 4},
+		Before: output{Proto: "HTTP/1.1"},
+		After:  output{Proto: "HTTP/2.0"},
+		Diffs:  []diff{{Field: "name"}},
+	}
+	assert.Equal(t, rowState{
+		Row:       4,
+		Fields:    []string{"name"},
+		Protocols: map[string]string{"before": "HTTP/1.1", "after": "HTTP/2.0"},
+	}, newRowState(r))
+}
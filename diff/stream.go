@@ -0,0 +1,280 @@
+package diff
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/itchyny/gojq"
+)
+
+// Stream types of JSON Lines rows and scenario steps
+const (
+	StreamSSE       = "sse"
+	StreamWebSocket = "websocket"
+)
+
+const defaultStreamWindow = 5 * time.Second
+
+type (
+	// Stream describes a streaming connection of a row, i.e.
+	//
+	//	{"path": "/prices", "stream": {"type": "websocket", "send": [{"subscribe": "AAPL"}], "events": 3}}
+	//
+	// Events are collected until N events are received, the window ends or
+	// the server closes the connection.
+	Stream struct {
+		Type   string            `json:"type"`             // sse or websocket
+		Send   []json.RawMessage `json:"send,omitempty"`   // websocket messages sent after connecting
+		Events int               `json:"events,omitempty"` // stop after N events, unlimited when 0
+		Window string            `json:"window,omitempty"` // stop after a duration, default: 5s
+	}
+
+	// streamEvent is a server-sent event or a websocket message
+	streamEvent struct {
+		event string // the type of a server-sent event
+		data  []byte
+	}
+)
+
+func (s Stream) window() (time.Duration, error) {
+	if s.Window == "" {
+		return defaultStreamWindow, nil
+	}
+	d, err := time.ParseDuration(s.Window)
+	if err != nil {
+		return 0, fmt.Errorf("stream window: %w", err)
+	}
+	return d, nil
+}
+
+// newStreamOutput collects the events of a stream. Every event is compared as
+// a field, i.e. "events[0]", and the type of server-sent events as
+// "events[0].event". The number of events is compared as "count", and the raw
+// body is the array of events, so scenarios can capture from it.
+func newStreamOutput(ctx context.Context, t *target, i input, jq *gojq.Query) (output, error) {
+	o := output{}
+
+	window, err := i.Stream.window()
+	if err != nil {
+		return o, err
+	}
+	wctx, cancel := context.WithTimeout(ctx, window)
+	defer cancel()
+
+	var events []streamEvent
+	switch i.Stream.Type {
+	case StreamSSE:
+		events, err = readSSE(wctx, t, i, &o)
+	case StreamWebSocket:
+		events, err = readWebSocket(wctx, t, i, &o)
+	default:
+		return o, fmt.Errorf("unsupported stream type %q", i.Stream.Type)
+	}
+	if ctx.Err() != nil {
+		return o, ctx.Err()
+	}
+	if err != nil {
+		return o, err
+	}
+
+	o.Body = map[string]json.RawMessage{
+		"count": json.RawMessage(strconv.Itoa(len(events))),
+	}
+	values := make([]json.RawMessage, len(events))
+	for n, e := range events {
+		v, err := eventValue(e.data, jq)
+		if err != nil {
+			return o, fmt.Errorf("event #%d: %w", n, err)
+		}
+		values[n] = v
+
+		key := "events[" + strconv.Itoa(n) + "]"
+		o.Body[key] = v
+		if e.event != "" && e.event != "message" {
+			o.Body[key+".event"], _ = json.Marshal(e.event)
+		}
+	}
+	o.Raw, err = json.Marshal(values)
+	return o, err
+}
+
+// eventValue returns the JSON of an event, or the event as a JSON string when
+// it isn't JSON. The jq query is applied to every event.
+func eventValue(data []byte, jq *gojq.Query) (json.RawMessage, error) {
+	var v interface{}
+	if err := json.Unmarshal(data, &v); err != nil {
+		v = string(data)
+	}
+
+	if jq != nil {
+		res, err := runJqQuery(jq, v)
+		if err != nil {
+			return nil, err
+		}
+		v = res
+		if len(res) == 1 {
+			v = res[0]
+		}
+	}
+	return json.Marshal(v)
+}
+
+// readSSE reads server-sent events until the context is done
+func readSSE(ctx context.Context, t *target, i input, o *output) ([]streamEvent, error) {
+	headers := make(map[string]string, len(i.Headers)+1)
+	for k, v := range i.Headers {
+		headers[k] = v
+	}
+	headers["Accept"] = "text/event-stream"
+	i.Headers = headers
+
+	resp, err := t.do(ctx, i)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	o.Code, o.Proto = resp.Status, resp.Proto
+	o.ContentType = resp.Header.Get("Content-Type")
+	if resp.StatusCode >= http.StatusMultipleChoices {
+		return nil, nil
+	}
+
+	var events []streamEvent
+	var data []string
+	event := ""
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 0, 64*1024), 10*1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case line == "":
+			// a blank line dispatches the event
+			if len(data) > 0 {
+				events = append(events, streamEvent{event: event, data: []byte(strings.Join(data, "\n"))})
+				if i.Stream.Events > 0 && len(events) >= i.Stream.Events {
+					return events, nil
+				}
+			}
+			data, event = nil, ""
+		case strings.HasPrefix(line, ":"):
+			// comment
+		default:
+			field, value := line, ""
+			if n := strings.Index(line, ":"); n != -1 {
+				field, value = line[:n], strings.TrimPrefix(line[n+1:], " ")
+			}
+			switch field {
+			case "data":
+				data = append(data, value)
+			case "event":
+				event = value
+			}
+		}
+	}
+
+	// reads fail when the window ends
+	if err := scanner.Err(); err != nil && ctx.Err() == nil {
+		return nil, err
+	}
+	return events, nil
+}
+
+// readWebSocket sends the messages of the stream and reads messages until
+// the context is done
+func readWebSocket(ctx context.Context, t *target, i input, o *output) ([]streamEvent, error) {
+	u, err := url.Parse(i.Path)
+	if err != nil {
+		return nil, err
+	}
+	switch u.Scheme {
+	case "http":
+		u.Scheme = "ws"
+	case "https":
+		u.Scheme = "wss"
+	}
+
+	header := http.Header{}
+	for k, v := range i.Headers {
+		header.Set(k, v)
+	}
+	if t.auth != nil {
+		token, err := t.auth.Token(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("%s auth: %w", t.name, err)
+		}
+		header.Set(t.auth.header, t.auth.prefix+token)
+	}
+	// the upgrade request is signed like any other request
+	if t.signer != nil {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, i.Path, nil)
+		if err != nil {
+			return nil, err
+		}
+		req.Header = header
+		if err := t.signer.sign(req, nil, time.Now()); err != nil {
+			return nil, fmt.Errorf("%s signing: %w", t.name, err)
+		}
+	}
+
+	dialer, err := t.webSocketDialer()
+	if err != nil {
+		return nil, err
+	}
+	conn, resp, err := dialer.DialContext(ctx, u.String(), header)
+	if errors.Is(err, websocket.ErrBadHandshake) && resp != nil {
+		// the status is compared like the status of any other response
+		resp.Body.Close()
+		o.Code, o.Proto = resp.Status, resp.Proto
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", t.name, err)
+	}
+	defer conn.Close()
+	o.Code, o.Proto = resp.Status, StreamWebSocket
+
+	// unblock reads when the window ends
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.Close()
+		case <-done:
+		}
+	}()
+
+	for _, m := range i.Stream.Send {
+		msg := []byte(m)
+		var s string
+		if err := json.Unmarshal(m, &s); err == nil {
+			msg = []byte(s)
+		}
+		if err := conn.WriteMessage(websocket.TextMessage, msg); err != nil {
+			return nil, fmt.Errorf("%s: %w", t.name, err)
+		}
+	}
+
+	var events []streamEvent
+	for i.Stream.Events == 0 || len(events) < i.Stream.Events {
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			// the window ended or the server closed the connection
+			break
+		}
+		events = append(events, streamEvent{data: data})
+	}
+
+	_ = conn.WriteControl(websocket.CloseMessage,
+		websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""), time.Now().Add(time.Second))
+	return events, nil
+}
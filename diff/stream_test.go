@@ -0,0 +1,161 @@
+package diff
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+)
+
+// newStreamServer streams 3 events over SSE, where the price of the second
+// event is given, and replies to a websocket subscription
+func newStreamServer(price int) *httptest.Server {
+	upgrader := websocket.Upgrader{}
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/sse":
+			w.Header().Set("Content-Type", "text/event-stream")
+			fmt.Fprint(w, ": comment\n\ndata: {\"price\": 1}\n\n")
+			fmt.Fprintf(w, "event: tick\ndata: {\"price\": %d}\n\n", price)
+			fmt.Fprint(w, "data: done\n\n")
+			w.(http.Flusher).Flush()
+			<-r.Context().Done()
+		case "/ws":
+			conn, err := upgrader.Upgrade(w, r, nil)
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+
+			var sub struct {
+				Subscribe string `json:"subscribe"`
+			}
+			if err := conn.ReadJSON(&sub); err != nil {
+				return
+			}
+			_ = conn.WriteJSON(map[string]string{"subscribed": sub.Subscribe})
+			_ = conn.WriteJSON(map[string]int{"price": 1})
+			_, _, _ = conn.ReadMessage()
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+}
+
+func Test_streamCompare(t *testing.T) {
+	before := newStreamServer(2)
+	defer before.Close()
+	after := newStreamServer(3)
+	defer after.Close()
+
+	c := Config{
+		BeforeBasePath:  before.URL,
+		AfterBasePath:   after.URL,
+		FixtureFilePath: "./testdata/stream.jsonl",
+	}
+	tests, err := generateTests(context.Background(), c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	targets, err := newTargets(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wantMatch, _ := parseMatch("exact")
+	got := map[int][]string{}
+	raw := map[int]string{}
+	for r := range compare(context.Background(), targets, tests, nil, wantMatch, nil, nil, nil) {
+		assert.NoError(t, r.err)
+		got[r.e.Row] = newRowState(r).Fields
+		raw[r.e.Row] = string(r.Before.Raw)
+	}
+
+	assert.Equal(t, map[int][]string{1: {"events[1]"}, 2: nil, 3: {"events[1]"}, 4: nil}, got)
+	assert.JSONEq(t, `[{"price": 1}, {"price": 2}]`, raw[1])
+	assert.JSONEq(t, `[{"subscribed": "AAPL"}, {"price": 1}]`, raw[2])
+	assert.JSONEq(t, `[{"price": 1}, {"price": 2}, "done"]`, raw[3])
+}
+
+func Test_newStreamOutput(t *testing.T) {
+	server := newStreamServer(2)
+	defer server.Close()
+
+	targets, err := newTargets(Config{BeforeBasePath: server.URL, AfterBasePath: server.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	jq, _ := parseQuery(".price", "")
+
+	o, err := newStreamOutput(context.Background(), targets[0], input{
+		Method: "GET",
+		Path:   server.URL + "/sse",
+		Stream: &Stream{Type: StreamSSE, Events: 2},
+	}, jq)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, map[string]json.RawMessage{
+		"count":           json.RawMessage("2"),
+		"events[0]":       json.RawMessage("1"),
+		"events[1]":       json.RawMessage("2"),
+		"events[1].event": json.RawMessage(`"tick"`),
+	}, o.Body)
+	assert.Equal(t, "200 OK", o.Code)
+
+	_, err = newStreamOutput(context.Background(), targets[0], input{Path: server.URL, Stream: &Stream{Type: "mqtt"}}, nil)
+	assert.EqualError(t, err, `unsupported stream type "mqtt"`)
+}
+
+func Test_newStreamOutputSigned(t *testing.T) {
+	dir, err := ioutil.TempDir("", "apicmp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	sign := filepath.Join(dir, "sign.yaml")
+	if err := ioutil.WriteFile(sign, []byte("type: hmac\nsecret: secret\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// the upgrade is only accepted with a signature
+	upgrader := websocket.Upgrader{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Signature") == "" || r.Header.Get("X-Timestamp") == "" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		_ = conn.WriteJSON(map[string]int{"price": 1})
+	}))
+	defer server.Close()
+
+	targets, err := newTargets(Config{
+		BeforeBasePath: server.URL,
+		AfterBasePath:  server.URL,
+		Targets:        map[string]TargetConfig{"before": {SignFilePath: sign}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	i := input{Method: "GET", Path: server.URL + "/ws", Stream: &Stream{Type: StreamWebSocket, Events: 1}}
+	signed, err := newStreamOutput(context.Background(), targets[0], i, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "101 Switching Protocols", signed.Code)
+	unsigned, err := newStreamOutput(context.Background(), targets[1], i, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "401 Unauthorized", unsigned.Code)
+}
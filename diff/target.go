@@ -0,0 +1,276 @@
+package diff
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/hashicorp/go-retryablehttp"
+)
+
+// TargetConfig configures how requests are sent to a single target. Every
+// target, i.e. before and after, can be configured separately.
+type TargetConfig struct {
+	AuthFilePath string   // YAML or JSON auth config, see authConfig
+	SignFilePath string   // YAML or JSON signing config, see signConfig
+	CACertFile   string   // PEM CA bundle trusted in addition to the system's CAs
+	CertFile     string   // PEM client certificate
+	KeyFile      string   // PEM key of the client certificate
+	Insecure     bool     // skip the verification of server certificates
+	Proxy        string   // http, https or socks5 proxy url
+	Resolve      []string // host:port:address overrides like curl's --resolve
+	UnixSocket   string   // set from unix:// base paths
+	Protocol     string   // h1.1, h2 or h2c, negotiated when empty
+}
+
+// curlOptions returns the curl options that reproduce a target's config
+func (tc TargetConfig) curlOptions() []string {
+	var opts []string
+	switch tc.Protocol {
+	case ProtocolHTTP1:
+		opts = append(opts, "--http1.1")
+	case ProtocolHTTP2:
+		opts = append(opts, "--http2")
+	case ProtocolH2C:
+		opts = append(opts, "--http2-prior-knowledge")
+	}
+	if tc.UnixSocket != "" {
+		opts = append(opts, "--unix-socket '"+tc.UnixSocket+"'")
+	}
+	if tc.Proxy != "" {
+		opts = append(opts, "--proxy '"+tc.Proxy+"'")
+	}
+	for _, r := range tc.Resolve {
+		opts = append(opts, "--resolve '"+r+"'")
+	}
+	if tc.CACertFile != "" {
+		opts = append(opts, "--cacert '"+tc.CACertFile+"'")
+	}
+	if tc.CertFile != "" {
+		opts = append(opts, "--cert '"+tc.CertFile+"'")
+	}
+	if tc.KeyFile != "" {
+		opts = append(opts, "--key '"+tc.KeyFile+"'")
+	}
+	if tc.Insecure {
+		opts = append(opts, "--insecure")
+	}
+	return opts
+}
+
+// withUnixSockets rewrites the unix:// base paths of a config to http
+// base paths and sets the sockets of their targets
+func (c Config) withUnixSockets() Config {
+	targets := make(map[string]TargetConfig, len(c.Targets))
+	for k, v := range c.Targets {
+		targets[k] = v
+	}
+	c.Targets = targets
+
+	names := targetNames(2 + len(c.CandidateBasePaths))
+	rewrite := func(name string, base *string) {
+		if socket, httpBase, ok := unixSocketBase(*base); ok {
+			tc := c.Targets[name]
+			tc.UnixSocket = socket
+			c.Targets[name] = tc
+			*base = httpBase
+		}
+	}
+
+	rewrite(names[0], &c.BeforeBasePath)
+	rewrite(names[1], &c.AfterBasePath)
+	c.CandidateBasePaths = append([]string{}, c.CandidateBasePaths...)
+	for i := range c.CandidateBasePaths {
+		rewrite(names[2+i], &c.CandidateBasePaths[i])
+	}
+	return c
+}
+
+// target sends the requests of a single side
+type target struct {
+	name     string
+	base     string
+	client   httpClient
+	auth     *tokenSource
+	signer   signer
+	protocol string
+	grpc     *grpcClient // set for grpc:// and grpcs:// base paths
+	config   TargetConfig
+
+	wsOnce sync.Once
+	ws     *websocket.Dialer
+	wsErr  error
+}
+
+// newTargets returns the before, after and candidate targets in that order
+func newTargets(c Config) ([]*target, error) {
+	bases := append([]string{c.BeforeBasePath, c.AfterBasePath}, c.CandidateBasePaths...)
+	names := targetNames(len(bases))
+
+	targets := make([]*target, len(bases))
+	for i, base := range bases {
+		t, err := newTarget(c, names[i], base)
+		if err != nil {
+			closeTargets(targets[:i])
+			return nil, err
+		}
+		targets[i] = t
+	}
+	return targets, nil
+}
+
+// closeTargets closes the connections of gRPC targets and the idle
+// connections of HTTP targets
+func closeTargets(targets []*target) {
+	for _, t := range targets {
+		if t.grpc != nil {
+			t.grpc.Close()
+		}
+		if c, ok := t.client.(*retryablehttp.Client); ok {
+			c.HTTPClient.CloseIdleConnections()
+		}
+	}
+}
+
+// newTarget returns a target with the TargetConfig of its name
+func newTarget(c Config, name, base string) (*target, error) {
+	tc := c.Targets[name]
+	client, err := newRetriableHTTPClient(c.Retry, tc)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	t := &target{
+		name:     name,
+		base:     base,
+		client:   client,
+		protocol: tc.Protocol,
+		config:   tc,
+	}
+	if isGRPCBase(base) {
+		t.grpc, err = newGRPCClient(base, tc, c.ProtoSetFiles)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", t.name, err)
+		}
+	}
+
+	if tc.AuthFilePath != "" {
+		auth, err := newTokenSource(tc.AuthFilePath, t)
+		if err != nil {
+			closeTargets([]*target{t})
+			return nil, fmt.Errorf("%s auth: %w", t.name, err)
+		}
+		t.auth = auth
+	}
+	if tc.SignFilePath != "" {
+		s, err := newSigner(tc.SignFilePath)
+		if err != nil {
+			closeTargets([]*target{t})
+			return nil, fmt.Errorf("%s signing: %w", t.name, err)
+		}
+		t.signer = s
+	}
+	return t, nil
+}
+
+// do sends a request. The auth token is added at request time, and a token
+// that's rejected with 401 Unauthorized is refreshed once.
+func (t *target) do(ctx context.Context, i input) (*http.Response, error) {
+	resp, token, err := t.send(ctx, i)
+	if err == nil && t.auth != nil && resp.StatusCode == http.StatusUnauthorized {
+		resp.Body.Close()
+		t.auth.invalidate(token)
+		resp, _, err = t.send(ctx, i)
+	}
+	return resp, err
+}
+
+// send sends a request and returns the auth token that was used
+func (t *target) send(ctx context.Context, i input) (*http.Response, string, error) {
+	var err error
+	var req *retryablehttp.Request
+	if i.Body != "" {
+		req, err = retryablehttp.NewRequest(i.Method, i.Path, []byte(i.Body))
+	} else {
+		req, err = retryablehttp.NewRequest(i.Method, i.Path, nil)
+	}
+	if err != nil {
+		return nil, "", err
+	}
+	for k, v := range i.Headers {
+		req.Header.Add(k, v)
+	}
+
+	var token string
+	if t.auth != nil {
+		token, err = t.auth.Token(ctx)
+		if err != nil {
+			return nil, "", fmt.Errorf("%s auth: %w", t.name, err)
+		}
+		req.Header.Set(t.auth.header, t.auth.prefix+token)
+	}
+
+	// signatures cover the final request, so they're computed last
+	if t.signer != nil {
+		if err := t.signer.sign(req.Request, []byte(i.Body), time.Now()); err != nil {
+			return nil, "", fmt.Errorf("%s signing: %w", t.name, err)
+		}
+	}
+
+	httpTraceReq(req)
+	resp, err := t.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, token, err
+	}
+	httpTraceResp(resp)
+
+	// the transport falls back to HTTP/1.1 for http:// urls with h2
+	if want := protocolMajor(t.protocol); want != 0 && resp.ProtoMajor != want {
+		resp.Body.Close()
+		return nil, token, fmt.Errorf("%s: %s was forced but the response is %s", t.name, t.protocol, resp.Proto)
+	}
+
+	return resp, token, nil
+}
+
+// returnRedirects stops the client from following redirects, so they're
+// returned like any other response
+func (t *target) returnRedirects() {
+	if client, ok := t.client.(*retryablehttp.Client); ok {
+		client.HTTPClient.CheckRedirect = func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		}
+	}
+}
+
+// webSocketDialer returns a dialer with the proxy, TLS and dialer config of
+// the target
+func (t *target) webSocketDialer() (*websocket.Dialer, error) {
+	t.wsOnce.Do(func() {
+		transport, err := newTransport(t.config)
+		if err != nil {
+			t.wsErr = err
+			return
+		}
+		t.ws = &websocket.Dialer{
+			Proxy:            transport.Proxy,
+			TLSClientConfig:  transport.TLSClientConfig,
+			NetDialContext:   transport.DialContext,
+			HandshakeTimeout: 30 * time.Second,
+		}
+	})
+	return t.ws, t.wsErr
+}
+
+// protocolMajor returns the major version of a forced protocol, 0 if none
+func protocolMajor(protocol string) int {
+	switch protocol {
+	case ProtocolHTTP1:
+		return 1
+	case ProtocolHTTP2, ProtocolH2C:
+		return 2
+	}
+	return 0
+}
@@ -1,36 +1,80 @@
 package diff
 
-import "text/template"
+import (
+	"strings"
+	"text/template"
+	"time"
+)
 
 const curlTemplate = `
-Testing Row: {{.Row}}
+Testing Row: {{.Row}}{{if .Name}} ({{.Name}}){{end}}
 ===============
 Before:
-curl --location --request {{ .Before.Method }} '{{ .Before.Path }}' \{{range $k, $v := .Before.Headers}}
---header '{{$k}}: {{$v}}' \{{end}}{{if ne (len .Before.Body) 0}}
---data-raw '{{ .Before.Body }}'{{end}}
+{{template "request" .Before}}
 
 After:
-curl --location --request {{ .After.Method }} '{{ .After.Path }}' \{{range $k, $v := .After.Headers}}
---header '{{$k}}: {{$v}}' \{{end}}{{if ne (len .After.Body) 0}}
---data-raw '{{ .After.Body }}'{{end}}
-
+{{template "request" .After}}
+{{range $i, $c := .Candidates}}
+Candidate{{inc $i}}:
+{{template "request" $c}}
+{{end}}
 `
 
+// requestTemplate is the curl command of a request, or the grpcurl command
+// of a gRPC call
+const requestTemplate = `{{if isGRPC .Path}}{{grpcurl .}}{{else}}curl --location --request {{ .Method }} '{{ .Path }}' \{{range .CurlOptions}}
+{{.}} \{{end}}{{range $k, $v := .Headers}}
+--header '{{$k}}: {{$v}}' \{{end}}{{if ne (len .Body) 0}}
+--data-raw '{{ .Body }}'{{end}}{{end}}`
+
 const summaryTemplate = `
 Summary:
   Total Tests : {{.Count}}
-  Passed      : {{.Passed}}
+  Passed      : {{.Passed}}{{if .AcceptedRows}} ({{len .AcceptedRows}} accepted by the baseline: {{.AcceptedRowsStr}}){{end}}
   Failed      : {{.Failed}}
-  Failed Rows : {{.FailedRowsStr}}
+  Failed Rows : {{.FailedRowsStr}}{{if .FailedStepsStr}}
+  Failed Steps: {{.FailedStepsStr}}{{end}}{{if .ErroredRowsStr}}
+  Errored Rows: {{.ErroredRowsStr}}{{end}}
   Time        : {{.Time}}
 
 Issues Found:
 `
 
+// trendTemplate compares the summaries of two runs of the history file
+const trendTemplate = `
+Run {{.From.ID}} ({{date .From.Start}}) -> Run {{.To.ID}} ({{date .To.Start}}):
+  Total Tests  : {{.FromSum.Count}} -> {{.ToSum.Count}}
+  Passed       : {{.FromSum.Passed}} -> {{.ToSum.Passed}}
+  Failed       : {{.FromSum.Failed}} -> {{.ToSum.Failed}}
+  Errored      : {{len .FromSum.ErroredRows}} -> {{len .ToSum.ErroredRows}}
+  Newly Failing: {{len .NewlyFailing}}{{if .NewlyFailingStr}} (rows {{.NewlyFailingStr}}){{end}}
+  Newly Fixed  : {{len .NewlyFixed}}{{if .NewlyFixedStr}} (rows {{.NewlyFixedStr}}){{end}}{{if .NotComparedRowsStr}}
+  Ran Once     : rows {{.NotComparedRowsStr}}{{end}}
+
+Fields:
+`
+
+const protocolTemplate = `Protocol: before {{.Before.Proto}}, after {{.After.Proto}}{{range $i, $c := .Candidates}}, candidate{{inc $i}} {{$c.Proto}}{{end}}
+`
+
+const voteTemplate = `Agree   : {{join .Agree ","}}{{if le (len .Agree) (len .Diverge)}} (no majority){{end}}
+Diverge : {{join .Diverge ","}}
+`
+
 var tpl *template.Template
 
 func init() {
-	tpl = template.Must(template.New("curl").Parse(curlTemplate))
+	funcs := template.FuncMap{
+		"inc":     func(i int) int { return i + 1 },
+		"join":    strings.Join,
+		"isGRPC":  isGRPCBase,
+		"grpcurl": grpcurl,
+		"date":    func(t time.Time) string { return t.Local().Format("2006-01-02 15:04:05") },
+	}
+	tpl = template.Must(template.New("curl").Funcs(funcs).Parse(curlTemplate))
+	tpl = template.Must(tpl.New("request").Parse(requestTemplate))
 	tpl = template.Must(tpl.New("summary").Parse(summaryTemplate))
+	tpl = template.Must(tpl.New("vote").Parse(voteTemplate))
+	tpl = template.Must(tpl.New("protocol").Parse(protocolTemplate))
+	tpl = template.Must(tpl.New("trend").Parse(trendTemplate))
 }
@@ -4,9 +4,11 @@ import (
 	"context"
 	"encoding/csv"
 	"errors"
+	"fmt"
 	"io"
 	"os"
 	"strings"
+	"time"
 
 	log "github.com/sirupsen/logrus"
 )
@@ -18,15 +20,27 @@ const (
 
 type (
 	test struct {
-		Row    int
-		Before input
-		After  input
+		Row        int
+		Name       string // scenario#step of scenario files
+		Before     input
+		After      input
+		Candidates []input
+		Options    Options
+		Scenario   *scenarioRun // runs the steps of a scenario instead
+		GraphQL    bool         // compare GraphQL responses by operation and field path
+		Route      string       // the method and normalized path, i.e. GET /users/{id}
+
+		err error // the row can't be sent, it's reported as errored
 	}
 	input struct {
-		Method  string
-		Path    string
-		Headers map[string]string
-		Body    string
+		Method   string
+		Path     string
+		Headers  map[string]string
+		Body     string
+		Stream   *Stream
+		Paginate *Paginate
+
+		CurlOptions []string // options of the target, i.e. --proxy
 	}
 )
 
@@ -35,6 +49,7 @@ type csvHelper struct {
 	path    int
 	body    int
 	headers map[string]int
+	ignored int
 }
 
 func newCSVHelper(header []string) csvHelper {
@@ -59,6 +74,10 @@ func newCSVHelper(header []string) csvHelper {
 		case "body":
 			h.body = k
 
+		case originalRowColumn, failedFieldsColumn:
+			// added by --write-failures
+			h.ignored++
+
 		default:
 			// anything else is a header
 			h.headers[v] = k
@@ -125,52 +144,53 @@ func (h csvHelper) totalFields() int {
 	if length := len(h.headers); length != 0 {
 		count += length
 	}
+	count += h.ignored
 
 	return count
 }
 
 func generateTests(ctx context.Context, c Config) (<-chan test, error) {
-	// read csv file
-	f, err := os.Open(c.FixtureFilePath)
-	if err != nil {
-		return nil, err
+	if fixtureFormat(c) == FormatScenario {
+		return generateScenarioTests(ctx, c)
 	}
-	reader := csv.NewReader(f)
-	reader.LazyQuotes = true
 
-	// lets determine the shape of this CSV file based on the header
-	header, err := reader.Read()
+	r, err := newFixtureReader(c)
 	if err != nil {
 		return nil, err
 	}
-	h := newCSVHelper(header)
-	if err := h.validate(); err != nil {
-		return nil, err
+	if c.Dedupe || c.Sample > 0 || c.SamplePerRoute > 0 {
+		r = newSampleReader(r, c)
 	}
-
-	totalFields := h.totalFields()
+	headers := parseHeaders(c.Headers)
+	names := targetNames(2 + len(c.CandidateBasePaths))
+	graphQL := fixtureFormat(c) == FormatGraphQL
+	// the dynamic variables of Postman are templates
+	templates := c.Templates || fixtureFormat(c) == FormatPostman
+	seeds := newSeeds()
 
 	// generate tests
 	out := make(chan test)
 	go func() {
 		defer close(out)
-		defer f.Close()
+		defer r.Close()
 		cursor := 0
 
 		for {
 			cursor++
 
-			fields, err := reader.Read()
+			f, err := r.Read()
 			if err != nil {
 				if err == io.EOF {
 					break
 				}
-				log.Error(err)
-				continue
-			}
-
-			if len(fields) != totalFields {
-				log.Errorf("invalid row at #%d", cursor)
+				if err == errSkipRow {
+					continue
+				}
+				if err == errInvalidRow {
+					log.Errorf("invalid row at #%d", cursor)
+				} else {
+					log.Error(err)
+				}
 				continue
 			}
 
@@ -180,34 +200,30 @@ func generateTests(ctx context.Context, c Config) (<-chan test, error) {
 				}
 			}
 
-			t := test{
-				Row: cursor,
-				Before: input{
-					Method:  h.Method(fields),
-					Path:    buildURL(c.BeforeBasePath, h.Path(fields), c.QueryStrings, c.IgnoreQueryStrings),
-					Headers: h.Headers(fields),
-					Body:    h.Body(fields),
-				},
-				After: input{
-					Method:  h.Method(fields),
-					Path:    buildURL(c.AfterBasePath, h.Path(fields), c.QueryStrings, c.IgnoreQueryStrings),
-					Headers: h.Headers(fields),
-					Body:    h.Body(fields),
-				},
+			if _, ok := c.completed[cursor]; ok {
+				continue
 			}
 
-			for _, h := range c.Headers {
-				parts := strings.Split(h, ":")
-				if len(parts) != headerParts {
-					log.Errorf("skipping invalid header --header %s", h)
-					continue
+			var renderErr error
+			if templates {
+				data := map[string]interface{}{"row": cursor}
+				f, renderErr = renderFixture(f, data, newFixtureFuncs(seeds.Int63(), time.Now()))
+				if renderErr != nil {
+					renderErr = fmt.Errorf("invalid template: %w", renderErr)
 				}
+			}
 
-				k := strings.TrimSpace(parts[0])
-				v := strings.TrimSpace(parts[1])
-
-				t.Before.Headers[k] = v
-				t.After.Headers[k] = v
+			t := test{
+				Row:     cursor,
+				Before:  newInput(c, names[0], c.BeforeBasePath, f, headers),
+				After:   newInput(c, names[1], c.AfterBasePath, f, headers),
+				Options: f.Options,
+				GraphQL: graphQL,
+				Route:   f.Method + " " + normalizeRoute(f.Path),
+				err:     renderErr,
+			}
+			for n, base := range c.CandidateBasePaths {
+				t.Candidates = append(t.Candidates, newInput(c, names[2+n], base, f, headers))
 			}
 
 			select {
@@ -220,3 +236,106 @@ func generateTests(ctx context.Context, c Config) (<-chan test, error) {
 
 	return out, nil
 }
+
+func newInput(c Config, name, base string, f Fixture, headers map[string]string) input {
+	i := input{
+		Method:      f.Method,
+		Path:        buildURL(base, f.Path, c.QueryStrings, c.IgnoreQueryStrings),
+		Headers:     make(map[string]string, len(f.Headers)+len(headers)),
+		Body:        f.Body,
+		Stream:      f.Stream,
+		Paginate:    f.Paginate,
+		CurlOptions: c.Targets[name].curlOptions(),
+	}
+	if i.Paginate == nil {
+		i.Paginate = c.Paginate
+	}
+	if f.Stream != nil && f.Stream.Type == StreamSSE {
+		i.CurlOptions = append(i.CurlOptions, "--no-buffer")
+	}
+	if isGRPCBase(base) {
+		i.CurlOptions = grpcurlOptions(base, c.Targets[name], c.ProtoSetFiles)
+	}
+	for k, v := range f.Headers {
+		i.Headers[k] = v
+	}
+	for k, v := range headers {
+		i.Headers[k] = v
+	}
+
+	return i
+}
+
+// parseHeaders converts the --header options to a map
+func parseHeaders(hs []string) map[string]string {
+	out := make(map[string]string, len(hs))
+	for _, h := range hs {
+		parts := strings.Split(h, ":")
+		if len(parts) != headerParts {
+			log.Errorf("skipping invalid header --header %s", h)
+			continue
+		}
+
+		k := strings.TrimSpace(parts[0])
+		v := strings.TrimSpace(parts[1])
+		out[k] = v
+	}
+	return out
+}
+
+type csvReader struct {
+	f           *os.File
+	reader      *csv.Reader
+	h           csvHelper
+	totalFields int
+}
+
+func newCSVReader(path string) (*csvReader, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	reader := csv.NewReader(f)
+	reader.LazyQuotes = true
+
+	// lets determine the shape of this CSV file based on the header
+	header, err := reader.Read()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	h := newCSVHelper(header)
+	if err := h.validate(); err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	return &csvReader{
+		f:           f,
+		reader:      reader,
+		h:           h,
+		totalFields: h.totalFields(),
+	}, nil
+}
+
+func (r *csvReader) Read() (Fixture, error) {
+	fields, err := r.reader.Read()
+	if err != nil {
+		return Fixture{}, err
+	}
+
+	if len(fields) != r.totalFields {
+		return Fixture{}, errInvalidRow
+	}
+
+	return Fixture{
+		Method:  r.h.Method(fields),
+		Path:    r.h.Path(fields),
+		Headers: r.h.Headers(fields),
+		Body:    r.h.Body(fields),
+	}, nil
+}
+
+func (r *csvReader) Close() error {
+	return r.f.Close()
+}
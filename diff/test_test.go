@@ -28,7 +28,8 @@ func Test_generateTests(t *testing.T) {
 			},
 			want: []test{
 				{
-					Row: 1,
+					Row:   1,
+					Route: "GET /users/{id}",
 					Before: input{
 						Method: "GET",
 						Path:   "http://before.api.com/users/1",
@@ -49,7 +50,8 @@ func Test_generateTests(t *testing.T) {
 					},
 				},
 				{
-					Row: 2,
+					Row:   2,
+					Route: "GET /users/{id}",
 					Before: input{
 						Method: "GET",
 						Path:   "http://before.api.com/users/2",
@@ -83,7 +85,8 @@ func Test_generateTests(t *testing.T) {
 			},
 			want: []test{
 				{
-					Row: 1,
+					Row:   1,
+					Route: "POST /users/create",
 					Before: input{
 						Method: "POST",
 						Path:   "http://before.api.com/users/create",
@@ -106,7 +109,8 @@ func Test_generateTests(t *testing.T) {
 					},
 				},
 				{
-					Row: 2,
+					Row:   2,
+					Route: "POST /users/create",
 					Before: input{
 						Method: "POST",
 						Path:   "http://before.api.com/users/create",
@@ -131,6 +135,54 @@ func Test_generateTests(t *testing.T) {
 			},
 			wantErr: false,
 		},
+		{
+			name: "Test GET with candidate",
+			args: args{
+				c: Config{
+					BeforeBasePath:     "http://before.api.com",
+					AfterBasePath:      "http://after.api.com",
+					CandidateBasePaths: []string{"http://canary.api.com"},
+					FixtureFilePath:    "./testdata/get.csv",
+					Rows:               map[int]struct{}{1: {}},
+				},
+			},
+			want: []test{
+				{
+					Row:   1,
+					Route: "GET /users/{id}",
+					Before: input{
+						Method: "GET",
+						Path:   "http://before.api.com/users/1",
+						Headers: map[string]string{
+							"X-Api-Key":       "abcd",
+							"X-Forwarded-For": "192.168.1.1",
+							"Content-Type":    "application/json",
+						},
+					},
+					After: input{
+						Method: "GET",
+						Path:   "http://after.api.com/users/1",
+						Headers: map[string]string{
+							"X-Api-Key":       "abcd",
+							"X-Forwarded-For": "192.168.1.1",
+							"Content-Type":    "application/json",
+						},
+					},
+					Candidates: []input{
+						{
+							Method: "GET",
+							Path:   "http://canary.api.com/users/1",
+							Headers: map[string]string{
+								"X-Api-Key":       "abcd",
+								"X-Forwarded-For": "192.168.1.1",
+								"Content-Type":    "application/json",
+							},
+						},
+					},
+				},
+			},
+			wantErr: false,
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
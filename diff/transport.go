@@ -0,0 +1,173 @@
+package diff
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/go-cleanhttp"
+)
+
+const unixScheme = "unix://"
+
+// Protocols that can be forced per target. By default HTTP/2 is negotiated
+// over TLS and HTTP/1.1 is used otherwise.
+const (
+	ProtocolHTTP1 = "h1.1"
+	ProtocolHTTP2 = "h2"  // HTTP/2 over TLS
+	ProtocolH2C   = "h2c" // HTTP/2 over cleartext with prior knowledge
+)
+
+// newTransport returns the transport of a target. It's pooled like the
+// default transport of retryablehttp, so --threads reuse their connections.
+func newTransport(tc TargetConfig) (*http.Transport, error) {
+	transport := cleanhttp.DefaultPooledTransport()
+	// a target is a single host, every idle connection may be kept for it
+	transport.MaxIdleConnsPerHost = transport.MaxIdleConns
+	// negotiate HTTP/2 like http.DefaultTransport, despite the custom TLS config
+	transport.ForceAttemptHTTP2 = true
+
+	tlsConfig, err := newTLSConfig(tc)
+	if err != nil {
+		return nil, err
+	}
+	transport.TLSClientConfig = tlsConfig
+
+	if tc.Proxy != "" {
+		if tc.UnixSocket != "" {
+			return nil, errors.New("proxy: can't be used with a unix socket base path")
+		}
+		u, err := url.Parse(tc.Proxy)
+		if err != nil {
+			return nil, fmt.Errorf("proxy: %w", err)
+		}
+		switch u.Scheme {
+		case "http", "https", "socks5":
+		default:
+			return nil, fmt.Errorf("proxy: unsupported scheme %q", u.Scheme)
+		}
+		transport.Proxy = http.ProxyURL(u)
+	}
+
+	switch tc.Protocol {
+	case "":
+	case ProtocolHTTP1:
+		transport.Protocols = new(http.Protocols)
+		transport.Protocols.SetHTTP1(true)
+	case ProtocolHTTP2:
+		transport.Protocols = new(http.Protocols)
+		transport.Protocols.SetHTTP2(true)
+	case ProtocolH2C:
+		transport.Protocols = new(http.Protocols)
+		transport.Protocols.SetUnencryptedHTTP2(true)
+	default:
+		return nil, fmt.Errorf("protocol: unsupported protocol %q", tc.Protocol)
+	}
+
+	dial, err := newDialer(tc)
+	if err != nil {
+		return nil, err
+	}
+	if dial != nil {
+		transport.DialContext = dial
+	}
+
+	return transport, nil
+}
+
+// newDialer returns a dialer that connects to a unix socket, or to the
+// addresses of --resolve. Hosts aren't rewritten, so the Host header and SNI
+// stay intact.
+func newDialer(tc TargetConfig) (func(ctx context.Context, network, addr string) (net.Conn, error), error) {
+	d := &net.Dialer{
+		Timeout:   30 * time.Second,
+		KeepAlive: 30 * time.Second,
+	}
+
+	if tc.UnixSocket != "" {
+		return func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return d.DialContext(ctx, "unix", tc.UnixSocket)
+		}, nil
+	}
+
+	if len(tc.Resolve) == 0 {
+		return nil, nil
+	}
+	resolve := make(map[string]string, len(tc.Resolve))
+	for _, r := range tc.Resolve {
+		// host:port:address, the address may be an IPv6 address in brackets
+		parts := strings.SplitN(r, ":", 3)
+		if len(parts) != 3 || parts[0] == "" || parts[1] == "" || parts[2] == "" {
+			return nil, fmt.Errorf("resolve: invalid %q, expected host:port:address", r)
+		}
+		addr := strings.TrimSuffix(strings.TrimPrefix(parts[2], "["), "]")
+		resolve[net.JoinHostPort(parts[0], parts[1])] = net.JoinHostPort(addr, parts[1])
+	}
+
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		if override, ok := resolve[addr]; ok {
+			addr = override
+		}
+		return d.DialContext(ctx, network, addr)
+	}, nil
+}
+
+// unixSocketBase splits a unix:// base path into the socket and the base path
+// of its requests, i.e. unix:///var/run/api.sock:/v1 is sent to
+// http://localhost/v1 over /var/run/api.sock
+func unixSocketBase(base string) (socket, httpBase string, ok bool) {
+	if !strings.HasPrefix(base, unixScheme) {
+		return "", base, false
+	}
+
+	socket = strings.TrimPrefix(base, unixScheme)
+	prefix := ""
+	if i := strings.Index(socket, ":"); i != -1 {
+		socket, prefix = socket[:i], socket[i+1:]
+	}
+	return socket, "http://localhost" + prefix, true
+}
+
+// newTLSConfig adds the CA bundle to the system's CAs and loads the client
+// certificate of a target
+func newTLSConfig(tc TargetConfig) (*tls.Config, error) {
+	c := &tls.Config{
+		InsecureSkipVerify: tc.Insecure,
+	}
+
+	if tc.CACertFile != "" {
+		pem, err := ioutil.ReadFile(tc.CACertFile)
+		if err != nil {
+			return nil, fmt.Errorf("cacert: %w", err)
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil || pool == nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("cacert: no certificates found in %s", tc.CACertFile)
+		}
+		c.RootCAs = pool
+	}
+
+	if tc.CertFile != "" || tc.KeyFile != "" {
+		if tc.CertFile == "" || tc.KeyFile == "" {
+			return nil, errors.New("cert and key are required for client certificates")
+		}
+		cert, err := tls.LoadX509KeyPair(tc.CertFile, tc.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("cert: %w", err)
+		}
+		c.Certificates = []tls.Certificate{cert}
+	}
+
+	return c, nil
+}
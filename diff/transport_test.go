@@ -0,0 +1,303 @@
+package diff
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/go-retryablehttp"
+	"github.com/stretchr/testify/assert"
+)
+
+// writeClientCert writes a self-signed client certificate and its key
+func writeClientCert(t *testing.T, dir string) (*x509.Certificate, string, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "apicmp"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		IsCA:         true,
+
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certFile := writePEM(t, dir, "client.pem", "CERTIFICATE", der)
+	keyFile := writePEM(t, dir, "client-key.pem", "EC PRIVATE KEY", keyDER)
+	return cert, certFile, keyFile
+}
+
+func writePEM(t *testing.T, dir, name, typ string, der []byte) string {
+	path := filepath.Join(dir, name)
+	if err := ioutil.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: typ, Bytes: der}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func Test_newTransportTLS(t *testing.T) {
+	dir, err := ioutil.TempDir("", "apicmp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{}`)
+	})
+	server := httptest.NewTLSServer(handler)
+	defer server.Close()
+	caFile := writePEM(t, dir, "ca.pem", "CERTIFICATE", server.Certificate().Raw)
+
+	clientCert, certFile, keyFile := writeClientCert(t, dir)
+	mtls := httptest.NewUnstartedServer(handler)
+	clientCAs := x509.NewCertPool()
+	clientCAs.AddCert(clientCert)
+	mtls.TLS = &tls.Config{
+		ClientAuth: tls.RequireAndVerifyClientCert,
+		ClientCAs:  clientCAs,
+	}
+	mtls.StartTLS()
+	defer mtls.Close()
+
+	tests := []struct {
+		name    string
+		url     string
+		tc      TargetConfig
+		wantErr bool
+	}{
+		{name: "unknown CA", url: server.URL, wantErr: true},
+		{name: "CA bundle", url: server.URL, tc: TargetConfig{CACertFile: caFile}},
+		{name: "insecure", url: server.URL, tc: TargetConfig{Insecure: true}},
+		{name: "missing client certificate", url: mtls.URL, tc: TargetConfig{Insecure: true}, wantErr: true},
+		{name: "client certificate", url: mtls.URL, tc: TargetConfig{Insecure: true, CertFile: certFile, KeyFile: keyFile}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, err := newRetriableHTTPClient(nil, tt.tc)
+			if err != nil {
+				t.Fatal(err)
+			}
+			req, _ := retryablehttp.NewRequest("GET", tt.url, nil)
+			resp, err := client.Do(req)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			if assert.NoError(t, err) {
+				resp.Body.Close()
+				assert.Equal(t, http.StatusOK, resp.StatusCode)
+			}
+		})
+	}
+}
+
+func Test_newTLSConfigErrors(t *testing.T) {
+	_, err := newTLSConfig(TargetConfig{CertFile: "client.pem"})
+	assert.EqualError(t, err, "cert and key are required for client certificates")
+
+	_, err = newTLSConfig(TargetConfig{CACertFile: "./testdata/get.csv"})
+	assert.EqualError(t, err, "cacert: no certificates found in ./testdata/get.csv")
+}
+
+func Test_newTransportDialer(t *testing.T) {
+	dir, err := ioutil.TempDir("", "apicmp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// every server responds with how it was reached and the Host header
+	newHandler := func(via string) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprintf(w, "%s %s", via, r.Host)
+		})
+	}
+	server := httptest.NewServer(newHandler("direct"))
+	defer server.Close()
+	proxy := httptest.NewServer(newHandler("proxy"))
+	defer proxy.Close()
+
+	socket := filepath.Join(dir, "api.sock")
+	l, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	unix := &http.Server{Handler: newHandler("unix")}
+	go unix.Serve(l)
+	defer unix.Close()
+
+	_, port, _ := net.SplitHostPort(server.Listener.Addr().String())
+
+	tests := []struct {
+		name string
+		url  string
+		tc   TargetConfig
+		want string
+	}{
+		{name: "direct", url: server.URL, want: "direct " + server.Listener.Addr().String()},
+		{name: "proxy", url: "http://api.example.com/", tc: TargetConfig{Proxy: proxy.URL}, want: "proxy api.example.com"},
+		{name: "resolve", url: "http://api.example.com:" + port + "/", tc: TargetConfig{Resolve: []string{"api.example.com:" + port + ":127.0.0.1"}}, want: "direct api.example.com:" + port},
+		{name: "unix socket", url: "http://localhost/", tc: TargetConfig{UnixSocket: socket}, want: "unix localhost"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, err := newRetriableHTTPClient(nil, tt.tc)
+			if err != nil {
+				t.Fatal(err)
+			}
+			req, _ := retryablehttp.NewRequest("GET", tt.url, nil)
+			resp, err := client.Do(req)
+			if !assert.NoError(t, err) {
+				return
+			}
+			defer resp.Body.Close()
+			body, _ := ioutil.ReadAll(resp.Body)
+			assert.Equal(t, tt.want, string(body))
+		})
+	}
+}
+
+func Test_newTransportPool(t *testing.T) {
+	transport, err := newTransport(TargetConfig{Insecure: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// more than http.DefaultMaxIdleConnsPerHost, so --threads reuse their connections
+	assert.Equal(t, 100, transport.MaxIdleConnsPerHost)
+	assert.True(t, transport.ForceAttemptHTTP2)
+}
+
+func Test_newTransportErrors(t *testing.T) {
+	_, err := newTransport(TargetConfig{Proxy: "ftp://proxy.example.com"})
+	assert.EqualError(t, err, `proxy: unsupported scheme "ftp"`)
+
+	_, err = newTransport(TargetConfig{Proxy: "http://proxy:8080", UnixSocket: "/var/run/api.sock"})
+	assert.EqualError(t, err, "proxy: can't be used with a unix socket base path")
+
+	_, err = newTransport(TargetConfig{Protocol: "h3"})
+	assert.EqualError(t, err, `protocol: unsupported protocol "h3"`)
+
+	_, err = newTransport(TargetConfig{Resolve: []string{"api.example.com:443"}})
+	assert.EqualError(t, err, `resolve: invalid "api.example.com:443", expected host:port:address`)
+}
+
+func Test_unixSocketBase(t *testing.T) {
+	tests := []struct {
+		base       string
+		wantSocket string
+		wantBase   string
+		wantOK     bool
+	}{
+		{base: "https://api.example.com", wantBase: "https://api.example.com"},
+		{base: "unix:///var/run/api.sock", wantSocket: "/var/run/api.sock", wantBase: "http://localhost", wantOK: true},
+		{base: "unix:///var/run/api.sock:/v1", wantSocket: "/var/run/api.sock", wantBase: "http://localhost/v1", wantOK: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.base, func(t *testing.T) {
+			socket, base, ok := unixSocketBase(tt.base)
+			assert.Equal(t, tt.wantSocket, socket)
+			assert.Equal(t, tt.wantBase, base)
+			assert.Equal(t, tt.wantOK, ok)
+		})
+	}
+}
+
+func Test_withUnixSockets(t *testing.T) {
+	c := Config{
+		BeforeBasePath: "https://api.example.com",
+		AfterBasePath:  "unix:///var/run/api.sock:/v1",
+		Targets:        map[string]TargetConfig{"after": {CACertFile: "ca.pem"}},
+	}
+	got := c.withUnixSockets()
+
+	assert.Equal(t, "https://api.example.com", got.BeforeBasePath)
+	assert.Equal(t, "http://localhost/v1", got.AfterBasePath)
+	assert.Equal(t, TargetConfig{CACertFile: "ca.pem", UnixSocket: "/var/run/api.sock"}, got.Targets["after"])
+	assert.Equal(t, []string{"--unix-socket '/var/run/api.sock'", "--cacert 'ca.pem'"}, got.Targets["after"].curlOptions())
+	// the caller's config is unchanged
+	assert.Equal(t, "", c.Targets["after"].UnixSocket)
+}
+
+func Test_newTransportProtocol(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `{"proto":%q}`, r.Proto)
+	})
+	tlsServer := httptest.NewUnstartedServer(handler)
+	tlsServer.EnableHTTP2 = true
+	tlsServer.StartTLS()
+	defer tlsServer.Close()
+
+	server := httptest.NewUnstartedServer(handler)
+	server.Config.Protocols = new(http.Protocols)
+	server.Config.Protocols.SetHTTP1(true)
+	server.Config.Protocols.SetUnencryptedHTTP2(true)
+	server.Start()
+	defer server.Close()
+
+	tests := []struct {
+		name    string
+		url     string
+		tc      TargetConfig
+		want    string
+		wantErr bool
+	}{
+		{name: "negotiated over TLS", url: tlsServer.URL, tc: TargetConfig{Insecure: true}, want: "HTTP/2.0"},
+		{name: "h1.1 over TLS", url: tlsServer.URL, tc: TargetConfig{Insecure: true, Protocol: ProtocolHTTP1}, want: "HTTP/1.1"},
+		{name: "h2 over TLS", url: tlsServer.URL, tc: TargetConfig{Insecure: true, Protocol: ProtocolHTTP2}, want: "HTTP/2.0"},
+		{name: "negotiated over cleartext", url: server.URL, want: "HTTP/1.1"},
+		{name: "h2c", url: server.URL, tc: TargetConfig{Protocol: ProtocolH2C}, want: "HTTP/2.0"},
+		{name: "h2 over cleartext", url: server.URL, tc: TargetConfig{Protocol: ProtocolHTTP2}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			targets, err := newTargets(Config{
+				BeforeBasePath: tt.url,
+				AfterBasePath:  tt.url,
+				Targets:        map[string]TargetConfig{"before": tt.tc},
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			o, err := newOutput(context.Background(), targets[0], input{Method: "GET", Path: tt.url}, nil)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			if assert.NoError(t, err) {
+				assert.Equal(t, strconv.Quote(tt.want), string(o.Body["proto"]))
+				assert.Equal(t, tt.want, o.Proto)
+			}
+		})
+	}
+}
@@ -0,0 +1,110 @@
+package diff
+
+import (
+	"sort"
+	"strconv"
+
+	"github.com/arithran/jsondiff"
+)
+
+// targetNames returns the display names of n targets. The first two targets
+// are always the --before and --after targets, the rest are candidates.
+func targetNames(n int) []string {
+	names := make([]string, 0, n)
+	for i := 0; i < n; i++ {
+		switch i {
+		case 0:
+			names = append(names, "before")
+		case 1:
+			names = append(names, "after")
+		default:
+			names = append(names, "candidate"+strconv.Itoa(i-1))
+		}
+	}
+	return names
+}
+
+// equalOutputs compares a and b in both directions, so that a superset match
+// groups the same outputs whatever the order of the targets.
+func equalOutputs(a, b output, ignore map[string]struct{}, wantMatch jsondiff.Difference) bool {
+	return len(compareOutputs(a, b, ignore, wantMatch)) == 0 &&
+		len(compareOutputs(b, a, ignore, wantMatch)) == 0
+}
+
+// vote groups outputs that are equal to each other and treats the largest
+// group as the majority. Ties are won by the group that contains the earliest
+// target, so "before" wins when no majority exists.
+// Targets that failed, i.e. a candidate that can't be reached, don't vote and
+// diverge with an "_error" diff.
+// The returned diffs describe how every diverging target differs from the
+// majority in both directions and are prefixed with the target name, i.e.
+// "candidate1.field".
+func vote(outputs []output, names []string,
+	ignore map[string]struct{}, wantMatch jsondiff.Difference) (agree, diverge []string, diffs []diff) {
+	// each group holds indexes into outputs, the first index is the representative
+	groups := [][]int{}
+	memberOf := make([]int, len(outputs))
+	for i, o := range outputs {
+		memberOf[i] = -1
+		if o.err != nil {
+			continue
+		}
+		for g, members := range groups {
+			if equalOutputs(outputs[members[0]], o, ignore, wantMatch) {
+				groups[g] = append(groups[g], i)
+				memberOf[i] = g
+				break
+			}
+		}
+		if memberOf[i] == -1 {
+			groups = append(groups, []int{i})
+			memberOf[i] = len(groups) - 1
+		}
+	}
+
+	majority := 0
+	for g, members := range groups {
+		if len(members) > len(groups[majority]) {
+			majority = g
+		}
+	}
+
+	rep := outputs[groups[majority][0]]
+	for i, g := range memberOf {
+		if g == majority {
+			agree = append(agree, names[i])
+			continue
+		}
+
+		diverge = append(diverge, names[i])
+		if outputs[i].err != nil {
+			diffs = append(diffs, diff{
+				Field: names[i] + "._error",
+				Delta: outputs[i].err.Error(),
+			})
+			continue
+		}
+		// fields that only the target has are found the other way around
+		target := compareOutputs(rep, outputs[i], ignore, wantMatch)
+		seen := map[string]struct{}{}
+		for _, d := range target {
+			seen[d.Field] = struct{}{}
+		}
+		for _, d := range compareOutputs(outputs[i], rep, ignore, wantMatch) {
+			if _, ok := seen[d.Field]; !ok {
+				target = append(target, d)
+			}
+		}
+		sort.Slice(target, func(i, j int) bool {
+			return target[i].Field < target[j].Field
+		})
+		for _, d := range target {
+			diffs = append(diffs, diff{
+				Field: names[i] + "." + d.Field,
+				Delta: d.Delta,
+			})
+		}
+	}
+
+	return agree, diverge, diffs
+}
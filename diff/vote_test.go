@@ -0,0 +1,149 @@
+package diff
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/arithran/jsondiff"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_vote(t *testing.T) {
+	ok := output{
+		Code: "200 OK",
+		Body: map[string]json.RawMessage{"id": []byte("1"), "name": []byte(`"foo"`)},
+	}
+	changed := output{
+		Code: "200 OK",
+		Body: map[string]json.RawMessage{"id": []byte("1"), "name": []byte(`"bar"`)},
+	}
+	broken := output{
+		Code: "500 Internal Server Error",
+	}
+	failed := output{
+		err: errors.New("connection refused"),
+	}
+	extra := output{
+		Code: "200 OK",
+		Body: map[string]json.RawMessage{"id": []byte("1"), "name": []byte(`"foo"`), "age": []byte("2")},
+	}
+
+	tests := []struct {
+		name        string
+		outputs     []output
+		wantMatch   jsondiff.Difference
+		wantAgree   []string
+		wantDiverge []string
+		wantFields  []string
+	}{
+		{
+			name:      "all targets agree",
+			outputs:   []output{ok, ok, ok},
+			wantAgree: []string{"before", "after", "candidate1"},
+		},
+		{
+			name:        "candidate diverges",
+			outputs:     []output{ok, ok, changed},
+			wantAgree:   []string{"before", "after"},
+			wantDiverge: []string{"candidate1"},
+			wantFields:  []string{"candidate1.name"},
+		},
+		{
+			name:        "before is outvoted",
+			outputs:     []output{changed, ok, ok},
+			wantAgree:   []string{"after", "candidate1"},
+			wantDiverge: []string{"before"},
+			wantFields:  []string{"before.name"},
+		},
+		{
+			name:        "no majority falls back to before",
+			outputs:     []output{ok, changed, broken},
+			wantAgree:   []string{"before"},
+			wantDiverge: []string{"after", "candidate1"},
+			wantFields:  []string{"after.name", "candidate1._http.StatusCode"},
+		},
+		{
+			name:        "candidate with extra fields",
+			outputs:     []output{ok, ok, extra},
+			wantAgree:   []string{"before", "after"},
+			wantDiverge: []string{"candidate1"},
+			wantFields:  []string{"candidate1.age"},
+		},
+		{
+			name:        "candidate failed",
+			outputs:     []output{ok, changed, failed, changed},
+			wantAgree:   []string{"after", "candidate2"},
+			wantDiverge: []string{"before", "candidate1"},
+			wantFields:  []string{"before.name", "candidate1._error"},
+		},
+		{
+			name:        "superset doesn't depend on the order",
+			outputs:     []output{ok, extra, extra},
+			wantMatch:   jsondiff.SupersetMatch,
+			wantAgree:   []string{"after", "candidate1"},
+			wantDiverge: []string{"before"},
+			wantFields:  []string{"before.age"},
+		},
+		{
+			name:        "superset in the reverse order",
+			outputs:     []output{extra, extra, ok},
+			wantMatch:   jsondiff.SupersetMatch,
+			wantAgree:   []string{"before", "after"},
+			wantDiverge: []string{"candidate1"},
+			wantFields:  []string{"candidate1.age"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			agree, diverge, diffs := vote(tt.outputs, targetNames(len(tt.outputs)), nil, tt.wantMatch)
+
+			var fields []string
+			for _, d := range diffs {
+				fields = append(fields, d.Field)
+			}
+
+			assert.Equal(t, tt.wantAgree, agree)
+			assert.Equal(t, tt.wantDiverge, diverge)
+			assert.Equal(t, tt.wantFields, fields)
+		})
+	}
+}
+
+func Test_voteCompare(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"id": 1}`)
+	}))
+	defer srv.Close()
+	closed := httptest.NewServer(http.NotFoundHandler())
+	closed.Close()
+
+	c := Config{
+		BeforeBasePath:     srv.URL,
+		AfterBasePath:      srv.URL,
+		CandidateBasePaths: []string{closed.URL},
+	}
+	targets, err := newTargets(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := make(chan test, 1)
+	tests <- test{
+		Row:        1,
+		Before:     input{Method: "GET", Path: srv.URL + "/users/1"},
+		After:      input{Method: "GET", Path: srv.URL + "/users/1"},
+		Candidates: []input{{Method: "GET", Path: closed.URL + "/users/1"}},
+	}
+	close(tests)
+
+	for r := range compare(context.Background(), targets, tests, nil, jsondiff.FullMatch, nil, nil, nil) {
+		assert.NoError(t, r.err)
+		assert.Equal(t, []string{"before", "after"}, r.Agree)
+		assert.Equal(t, []string{"candidate1"}, r.Diverge)
+		assert.Equal(t, []string{"candidate1._error"}, newRowState(r).Fields)
+	}
+}
@@ -1,13 +1,39 @@
 module github.com/arithran/apicmp
 
-go 1.14
+// Go 1.24 is the minimum of github.com/itchyny/gojq (--jq), google.golang.org/grpc
+// and golang.org/x/sys, and of http.Protocols (--protocol). gojq also requires the
+// newer github.com/mattn/go-runewidth that tablewriter uses.
+go 1.24.0
 
 require (
 	github.com/arithran/jsondiff v0.0.0-20200908043949-cf4e0d03856b
+	github.com/gorilla/websocket v1.5.3
+	github.com/hashicorp/go-cleanhttp v0.5.1
 	github.com/hashicorp/go-retryablehttp v0.6.7
+	github.com/itchyny/gojq v0.12.19
 	github.com/olekukonko/tablewriter v0.0.4
 	github.com/sirupsen/logrus v1.6.0
-	github.com/stretchr/testify v1.2.2
+	github.com/stretchr/testify v1.10.0
 	github.com/urfave/cli/v2 v2.2.0
-	golang.org/x/sys v0.0.0-20191026070338-33540a1f6037 // indirect
+	go.etcd.io/bbolt v1.4.3
+	google.golang.org/grpc v1.79.3
+	google.golang.org/protobuf v1.36.10
+	gopkg.in/yaml.v3 v3.0.1
+)
+
+require (
+	github.com/clipperhouse/stringish v0.1.1 // indirect
+	github.com/clipperhouse/uax29/v2 v2.3.0 // indirect
+	github.com/cpuguy83/go-md2man/v2 v2.0.0-20190314233015-f79a8a8ca69d // indirect
+	github.com/davecgh/go-spew v1.1.1 // indirect
+	github.com/itchyny/timefmt-go v0.1.8 // indirect
+	github.com/konsorten/go-windows-terminal-sequences v1.0.3 // indirect
+	github.com/mattn/go-runewidth v0.0.19 // indirect
+	github.com/pmezard/go-difflib v1.0.0 // indirect
+	github.com/russross/blackfriday/v2 v2.0.1 // indirect
+	github.com/shurcooL/sanitized_anchor_name v1.0.0 // indirect
+	golang.org/x/net v0.48.0 // indirect
+	golang.org/x/sys v0.39.0 // indirect
+	golang.org/x/text v0.32.0 // indirect
+	google.golang.org/genproto/googleapis/rpc v0.0.0-20251202230838-ff82c1b0f217 // indirect
 )
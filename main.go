@@ -7,7 +7,10 @@ import (
 	"os"
 	"os/signal"
 	"regexp"
+	"strconv"
+	"strings"
 	"syscall"
+	"time"
 
 	"github.com/arithran/apicmp/diff"
 	"github.com/urfave/cli/v2"
@@ -18,55 +21,81 @@ var validMatches = map[string]struct{}{
 	"superset": {},
 }
 
+var validFormats = map[string]struct{}{
+	diff.FormatCSV:      {},
+	diff.FormatJSONL:    {},
+	diff.FormatHAR:      {},
+	diff.FormatPostman:  {},
+	diff.FormatScenario: {},
+	diff.FormatGRPC:     {},
+	diff.FormatGraphQL:  {},
+}
+
+var validPaginateTypes = map[string]struct{}{
+	diff.PaginateCursor: {},
+	diff.PaginateLink:   {},
+	diff.PaginatePage:   {},
+	diff.PaginateOffset: {},
+}
+
+var validLogFormats = map[string]struct{}{
+	diff.LogFormatNginx:  {},
+	diff.LogFormatApache: {},
+	diff.LogFormatJSON:   {},
+}
+
 func main() {
 	app := &cli.App{
 		Name:  "apicmp",
 		Usage: "The apicmp command diffs API responses between NodeJS and Go services",
 		Commands: []*cli.Command{
 			{
-				Name:  "diff",
-				Usage: "apicmp diff",
-				Flags: []cli.Flag{
+				Name:   "diff",
+				Usage:  "apicmp diff",
+				Flags:  diffFlags(),
+				Before: validateDiff,
+				Action: func(c *cli.Context) error {
+					ctx, cancel := context.WithCancel(c.Context)
+
+					go func() {
+						done := make(chan os.Signal, 1)
+						signal.Notify(done, os.Interrupt, syscall.SIGTERM)
+						<-done
+						cancel()
+					}()
+
+					return diff.Cmp(ctx, diffConfig(c))
+				},
+			},
+			{
+				Name:  "proxy",
+				Usage: "apicmp proxy (return the before response and compare it with after in the background)",
+				Flags: append([]cli.Flag{
+					&cli.StringFlag{
+						Name:  "listen",
+						Value: ":8080",
+						Usage: "address of the proxy",
+					},
 					&cli.StringFlag{
 						Name:    "before",
 						Aliases: []string{"B"},
-						Usage:   "https://api.example.com",
+						Usage:   "https://api.example.com (the responses returned to clients)",
 					},
 					&cli.StringFlag{
 						Name:    "after",
 						Aliases: []string{"A"},
 						Usage:   "https://qa-api.example.com",
 					},
-					&cli.StringFlag{
-						Name:    "file",
-						Aliases: []string{"F"},
-						Usage:   "~/Downloads/fixtures.csv",
-					},
 					&cli.StringSliceFlag{
 						Name:    "header",
 						Aliases: []string{"H"},
 						Usage:   "'Cache-Control: no-cache' ",
 					},
-					&cli.StringSliceFlag{
-						Name:    "querystring",
-						Aliases: []string{"Q"},
-						Usage:   "'key: value' ",
-					},
-					&cli.StringFlag{
-						Name:    "ignoreQuerystring",
-						Aliases: []string{"IQ"},
-						Usage:   "regex to delete matched query strings",
-					},
 					&cli.StringFlag{
 						Name:    "ignore",
 						Aliases: []string{"I"},
 						Usage:   "createdAt,modifiedAt",
 					},
-					&cli.StringFlag{
-						Name:    "rows",
-						Aliases: []string{"R"},
-						Usage:   "1,7,12 (Rerun failed or specific tests from file)",
-					},
 					&cli.StringFlag{
 						Name:  "retry",
 						Usage: "424,500 (HTTP status codes)",
@@ -86,15 +115,11 @@ func main() {
 						Value: "debug",
 						Usage: "info",
 					},
-					&cli.StringFlag{
-						Name:  "postman",
-						Usage: "~/Downloads/collection.json",
-					},
 					&cli.StringFlag{
 						Name:  "jq",
 						Usage: ".members | [] | .id",
 					},
-				},
+				}, targetFlags()...),
 				Before: func(c *cli.Context) error {
 					if c.String("before") == "" {
 						return errors.New("before required")
@@ -102,9 +127,6 @@ func main() {
 					if c.String("after") == "" {
 						return errors.New("after required")
 					}
-					if c.String("file") == "" {
-						return errors.New("file required")
-					}
 					if _, ok := validMatches[c.String("match")]; !ok {
 						return errors.New("invalid --match flag")
 					}
@@ -120,31 +142,382 @@ func main() {
 						cancel()
 					}()
 
-					var ignoreQuerystring *regexp.Regexp
-					if c.IsSet("ignoreQuerystring") {
-						if regex, err := regexp.Compile(c.String("ignoreQuerystring")); err == nil {
-							ignoreQuerystring = regex
-						}
+					return diff.Proxy(ctx, diff.ProxyConfig{
+						Listen: c.String("listen"),
+						Config: diff.Config{
+							BeforeBasePath: c.String("before"),
+							AfterBasePath:  c.String("after"),
+							Headers:        c.StringSlice("header"),
+							IgnoreFields:   diff.Atoam(c.String("ignore")),
+							Retry:          diff.Atoim(c.String("retry")),
+							Match:          c.String("match"),
+							LogLevel:       c.String("loglevel"),
+							Threads:        c.Int("threads"),
+							Jq:             c.String("jq"),
+							Targets:        targetConfigs(c),
+						},
+					})
+				},
+			},
+			{
+				Name:  "capture",
+				Usage: "apicmp capture (record the requests to a target as a fixture file)",
+				Flags: append([]cli.Flag{
+					&cli.StringFlag{
+						Name:  "listen",
+						Value: ":8080",
+						Usage: "address of the proxy",
+					},
+					&cli.StringFlag{
+						Name:    "target",
+						Aliases: []string{"T"},
+						Usage:   "https://api.example.com",
+					},
+					&cli.StringFlag{
+						Name:    "output",
+						Aliases: []string{"o"},
+						Usage:   "fixtures.csv (default: stdout)",
+					},
+					&cli.StringFlag{
+						Name:  "output-format",
+						Usage: "csv|jsonl (default: guessed from the --output extension, or csv)",
+					},
+					&cli.StringSliceFlag{
+						Name:  "allow-header",
+						Usage: "X-Tenant (capture a header, every header that isn't denied is captured in jsonl files by default)",
+					},
+					&cli.StringSliceFlag{
+						Name:  "deny-header",
+						Usage: "X-Session (never capture a header, in addition to " + strings.Join(diff.DefaultCaptureDenyHeaders, ", ") + ")",
+					},
+					&cli.BoolFlag{
+						Name:  "capture-secrets",
+						Usage: "capture " + strings.Join(diff.DefaultCaptureDenyHeaders, ", ") + " too",
+					},
+					&cli.StringFlag{
+						Name:  "snapshot",
+						Usage: "~/snapshots (record every response for apicmp serve)",
+					},
+					&cli.StringFlag{
+						Name:  "loglevel",
+						Value: "info",
+						Usage: "debug",
+					},
+				}, captureFlags()...),
+				Before: func(c *cli.Context) error {
+					if c.String("target") == "" {
+						return errors.New("target required")
+					}
+					return nil
+				},
+				Action: func(c *cli.Context) error {
+					ctx, cancel := context.WithCancel(c.Context)
+
+					go func() {
+						done := make(chan os.Signal, 1)
+						signal.Notify(done, os.Interrupt, syscall.SIGTERM)
+						<-done
+						cancel()
+					}()
+
+					return diff.Capture(ctx, diff.CaptureConfig{
+						Listen:         c.String("listen"),
+						TargetBasePath: c.String("target"),
+						Target:         targetConfigs(c)["before"],
+						OutputFilePath: c.String("output"),
+						Format:         c.String("output-format"),
+						AllowHeaders:   c.StringSlice("allow-header"),
+						DenyHeaders:    c.StringSlice("deny-header"),
+						CaptureSecrets: c.Bool("capture-secrets"),
+						SnapshotDir:    c.String("snapshot"),
+						LogLevel:       c.String("loglevel"),
+					})
+				},
+			},
+			{
+				Name:  "serve",
+				Usage: "apicmp serve (serve the responses recorded by apicmp capture --snapshot)",
+				Flags: append([]cli.Flag{
+					&cli.StringFlag{
+						Name:  "listen",
+						Value: ":8081",
+						Usage: "address of the server",
+					},
+					&cli.StringFlag{
+						Name:  "snapshot",
+						Usage: "~/snapshots",
+					},
+					&cli.StringFlag{
+						Name:  "fallback",
+						Value: "404",
+						Usage: "503 or https://api.example.com (the status code of unknown requests, or a target they're sent to)",
+					},
+					&cli.StringFlag{
+						Name:  "loglevel",
+						Value: "info",
+						Usage: "debug",
+					},
+				}, captureFlags()...),
+				Before: func(c *cli.Context) error {
+					if c.String("snapshot") == "" {
+						return errors.New("snapshot required")
 					}
+					return nil
+				},
+				Action: func(c *cli.Context) error {
+					ctx, cancel := context.WithCancel(c.Context)
+
+					go func() {
+						done := make(chan os.Signal, 1)
+						signal.Notify(done, os.Interrupt, syscall.SIGTERM)
+						<-done
+						cancel()
+					}()
 
-					return diff.Cmp(ctx, diff.Config{
-						BeforeBasePath:     c.String("before"),
-						AfterBasePath:      c.String("after"),
-						FixtureFilePath:    c.String("file"),
-						Headers:            c.StringSlice("header"),
-						QueryStrings:       c.StringSlice("querystring"),
-						IgnoreQueryStrings: ignoreQuerystring,
-						IgnoreFields:       diff.Atoam(c.String("ignore")),
-						Rows:               diff.Atoim(c.String("rows")),
-						Retry:              diff.Atoim(c.String("retry")),
-						Match:              c.String("match"),
-						LogLevel:           c.String("loglevel"),
-						Threads:            c.Int("threads"),
-						PostmanFilePath:    c.String("postman"),
-						Jq:                 c.String("jq"),
+					return diff.Serve(ctx, diff.ServeConfig{
+						Listen:      c.String("listen"),
+						SnapshotDir: c.String("snapshot"),
+						Fallback:    c.String("fallback"),
+						Target:      targetConfigs(c)["before"],
+						LogLevel:    c.String("loglevel"),
 					})
 				},
 			},
+			{
+				Name:  "history",
+				Usage: "apicmp history (list the runs of a history file)",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:  "history",
+						Usage: "~/apicmp.db",
+					},
+					&cli.IntFlag{
+						Name:  "limit",
+						Usage: "20 (the most recent runs)",
+					},
+				},
+				Action: func(c *cli.Context) error {
+					// validated here, since Before also runs for subcommands
+					if c.String("history") == "" {
+						return errors.New("history required")
+					}
+					return diff.History(diff.HistoryConfig{
+						FilePath: c.String("history"),
+						Limit:    c.Int("limit"),
+					})
+				},
+				Subcommands: []*cli.Command{
+					{
+						Name:      "compare",
+						Usage:     "apicmp history compare (newly failing and newly fixed rows and fields between two runs)",
+						ArgsUsage: "RUN1 RUN2",
+						Flags: []cli.Flag{
+							&cli.StringFlag{
+								Name:  "history",
+								Usage: "~/apicmp.db",
+							},
+						},
+						Before: func(c *cli.Context) error {
+							if c.String("history") == "" {
+								return errors.New("history required")
+							}
+							if c.Args().Len() != 2 {
+								return errors.New("two runs required")
+							}
+							return nil
+						},
+						Action: func(c *cli.Context) error {
+							from, err := strconv.ParseUint(c.Args().Get(0), 10, 64)
+							if err != nil {
+								return errors.New("invalid run " + c.Args().Get(0))
+							}
+							to, err := strconv.ParseUint(c.Args().Get(1), 10, 64)
+							if err != nil {
+								return errors.New("invalid run " + c.Args().Get(1))
+							}
+							return diff.HistoryCompare(diff.HistoryConfig{FilePath: c.String("history")}, from, to)
+						},
+					},
+				},
+			},
+			{
+				Name:  "baseline",
+				Usage: "apicmp baseline (manage the accepted differences of a baseline file)",
+				Subcommands: []*cli.Command{
+					{
+						Name:  "update",
+						Usage: "apicmp baseline update (run diff and accept its differences in the --baseline file)",
+						Flags: append(diffFlags(), &cli.StringFlag{
+							Name:  "expires",
+							Usage: "2026-12-31 (the last day the new entries are accepted)",
+						}),
+						Before: func(c *cli.Context) error {
+							if err := validateDiff(c); err != nil {
+								return err
+							}
+							if c.String("baseline") == "" {
+								return errors.New("baseline required")
+							}
+							if _, err := time.Parse("2006-01-02", c.String("expires")); c.IsSet("expires") && err != nil {
+								return errors.New("invalid --expires flag, expected YYYY-MM-DD")
+							}
+							return nil
+						},
+						Action: func(c *cli.Context) error {
+							ctx, cancel := context.WithCancel(c.Context)
+
+							go func() {
+								done := make(chan os.Signal, 1)
+								signal.Notify(done, os.Interrupt, syscall.SIGTERM)
+								<-done
+								cancel()
+							}()
+
+							config := diffConfig(c)
+							config.BaselineUpdate = true
+							config.BaselineExpires = c.String("expires")
+							return diff.Cmp(ctx, config)
+						},
+					},
+				},
+			},
+			{
+				Name:  "gen",
+				Usage: "apicmp gen",
+				Subcommands: []*cli.Command{
+					{
+						Name:      "openapi",
+						Usage:     "generate a fixture file covering every GET operation of an OpenAPI 3 spec",
+						ArgsUsage: "spec.yaml",
+						Flags: []cli.Flag{
+							&cli.StringFlag{
+								Name:    "output",
+								Aliases: []string{"o"},
+								Usage:   "~/Downloads/fixtures.csv (default: stdout)",
+							},
+							&cli.StringFlag{
+								Name:  "format",
+								Usage: "csv|jsonl (default: guessed from the --output extension)",
+							},
+							&cli.StringFlag{
+								Name:  "values",
+								Usage: "~/Downloads/values.yaml (parameter values by name)",
+							},
+							&cli.IntFlag{
+								Name:  "max-rows",
+								Value: 10,
+								Usage: "maximum rows per operation",
+							},
+							&cli.StringFlag{
+								Name:  "loglevel",
+								Value: "info",
+								Usage: "debug",
+							},
+						},
+						Before: func(c *cli.Context) error {
+							if c.Args().Len() != 1 {
+								return errors.New("spec file required")
+							}
+							return nil
+						},
+						Action: func(c *cli.Context) error {
+							return diff.GenOpenAPI(diff.GenOpenAPIConfig{
+								SpecFilePath:   c.Args().First(),
+								ValuesFilePath: c.String("values"),
+								OutputFilePath: c.String("output"),
+								Format:         c.String("format"),
+								MaxRows:        c.Int("max-rows"),
+								LogLevel:       c.String("loglevel"),
+							})
+						},
+					},
+					{
+						Name:      "logs",
+						Usage:     "generate a fixture file from nginx, apache or JSON access logs",
+						ArgsUsage: "access.log [access.log.1.gz ...]",
+						Flags: []cli.Flag{
+							&cli.StringFlag{
+								Name:  "format",
+								Value: diff.LogFormatNginx,
+								Usage: "nginx|apache|json",
+							},
+							&cli.StringFlag{
+								Name:    "output",
+								Aliases: []string{"o"},
+								Usage:   "~/Downloads/fixtures.csv (default: stdout)",
+							},
+							&cli.StringFlag{
+								Name:  "output-format",
+								Usage: "csv|jsonl (default: guessed from the --output extension)",
+							},
+							&cli.StringSliceFlag{
+								Name:    "header",
+								Aliases: []string{"H"},
+								Usage:   "User-Agent|Referer|X-Forwarded-For (nginx and apache logs)",
+							},
+							&cli.StringSliceFlag{
+								Name:  "field",
+								Usage: "path=request.uri,header:X-Api-Key=request.headers.x-api-key (json logs, keys: method|path|body|header:<name>)",
+							},
+							&cli.StringSliceFlag{
+								Name:  "method",
+								Value: cli.NewStringSlice("GET"),
+								Usage: "methods to keep",
+							},
+							&cli.IntFlag{
+								Name:  "sample",
+								Usage: "keep 1 of every N unique requests",
+							},
+							&cli.Int64Flag{
+								Name:  "seed",
+								Usage: "seed of the sampling (default: random)",
+							},
+							&cli.StringFlag{
+								Name:  "loglevel",
+								Value: "info",
+								Usage: "debug",
+							},
+						},
+						Before: func(c *cli.Context) error {
+							if c.Args().Len() == 0 {
+								return errors.New("log file required")
+							}
+							if _, ok := validLogFormats[c.String("format")]; !ok {
+								return errors.New("invalid --format flag")
+							}
+							return nil
+						},
+						Action: func(c *cli.Context) error {
+							fields := map[string]string{}
+							for _, f := range c.StringSlice("field") {
+								kv := strings.SplitN(f, "=", 2)
+								if len(kv) != 2 {
+									return errors.New("invalid --field flag " + f)
+								}
+								fields[kv[0]] = kv[1]
+							}
+
+							methods := map[string]struct{}{}
+							for _, m := range c.StringSlice("method") {
+								methods[strings.ToUpper(m)] = struct{}{}
+							}
+
+							return diff.GenLogs(diff.GenLogsConfig{
+								LogFilePaths:   c.Args().Slice(),
+								LogFormat:      c.String("format"),
+								Fields:         fields,
+								Headers:        c.StringSlice("header"),
+								Methods:        methods,
+								SampleRate:     c.Int("sample"),
+								Seed:           c.Int64("seed"),
+								OutputFilePath: c.String("output"),
+								Format:         c.String("output-format"),
+								LogLevel:       c.String("loglevel"),
+							})
+						},
+					},
+				},
+			},
 		},
 	}
 
@@ -153,3 +526,366 @@ func main() {
 		log.Fatal(err)
 	}
 }
+
+// diffFlags returns the options of diff and baseline update
+func diffFlags() []cli.Flag {
+	return append([]cli.Flag{
+		&cli.StringFlag{
+			Name:    "before",
+			Aliases: []string{"B"},
+			Usage:   "https://api.example.com, unix:///var/run/api.sock:/v1 or grpc://localhost:50051",
+		},
+		&cli.StringFlag{
+			Name:    "after",
+			Aliases: []string{"A"},
+			Usage:   "https://qa-api.example.com",
+		},
+		&cli.StringSliceFlag{
+			Name:    "candidate",
+			Aliases: []string{"C"},
+			Usage:   "https://canary-api.example.com (compare 3 or more targets by majority vote)",
+		},
+		&cli.StringFlag{
+			Name:    "file",
+			Aliases: []string{"F"},
+			Usage:   "~/Downloads/fixtures.csv",
+		},
+		&cli.StringFlag{
+			Name:  "format",
+			Usage: "csv|jsonl|har|scenario|grpc|graphql (default: guessed from the --file extension)",
+		},
+		&cli.StringSliceFlag{
+			Name:    "header",
+			Aliases: []string{"H"},
+			Usage:   "'Cache-Control: no-cache' ",
+		},
+		&cli.StringSliceFlag{
+			Name:    "querystring",
+			Aliases: []string{"Q"},
+			Usage:   "'key: value' ",
+		},
+		&cli.StringFlag{
+			Name:    "ignoreQuerystring",
+			Aliases: []string{"IQ"},
+			Usage:   "regex to delete matched query strings",
+		},
+		&cli.StringFlag{
+			Name:    "ignore",
+			Aliases: []string{"I"},
+			Usage:   "createdAt,modifiedAt",
+		},
+		&cli.StringFlag{
+			Name:    "rows",
+			Aliases: []string{"R"},
+			Usage:   "1,7,12 (Rerun failed or specific tests from file)",
+		},
+		&cli.StringFlag{
+			Name:  "retry",
+			Usage: "424,500 (HTTP status codes)",
+		},
+		&cli.StringFlag{
+			Name:  "match",
+			Value: "exact",
+			Usage: "exact|superset",
+		},
+		&cli.StringFlag{
+			Name:  "threads",
+			Value: "4",
+			Usage: "10",
+		},
+		&cli.StringFlag{
+			Name:  "loglevel",
+			Value: "debug",
+			Usage: "info",
+		},
+		&cli.StringFlag{
+			Name:  "postman",
+			Usage: "~/Downloads/collection.json",
+		},
+		&cli.StringFlag{
+			Name:  "write-failures",
+			Usage: "~/Downloads/failed.csv (write failed and errored rows as a fixture file)",
+		},
+		&cli.StringFlag{
+			Name:  "postman-input",
+			Usage: "~/Downloads/collection.json (use a Postman v2.1 collection as the fixture file)",
+		},
+		&cli.StringFlag{
+			Name:  "postman-env",
+			Usage: "~/Downloads/environment.json (resolve {{variables}} of --postman-input)",
+		},
+		&cli.StringFlag{
+			Name:  "openapi",
+			Usage: "~/Downloads/spec.yaml (validate responses against an OpenAPI 3 spec)",
+		},
+		&cli.StringFlag{
+			Name:  "jq",
+			Usage: ".members | [] | .id",
+		},
+		&cli.IntFlag{
+			Name:  "sample",
+			Usage: "100 (sample rows evenly across routes, numeric and UUID path segments are collapsed)",
+		},
+		&cli.IntFlag{
+			Name:  "sample-per-route",
+			Usage: "10 (sample at most N rows per route)",
+		},
+		&cli.Int64Flag{
+			Name:  "seed",
+			Usage: "seed of --sample and --sample-per-route (default: random)",
+		},
+		&cli.BoolFlag{
+			Name:  "dedupe",
+			Usage: "drop duplicate rows (implied by --sample and --sample-per-route)",
+		},
+		&cli.BoolFlag{
+			Name:  "templates",
+			Usage: "evaluate {{...}} template expressions in fixture cells",
+		},
+		&cli.StringSliceFlag{
+			Name:  "protoset",
+			Usage: "~/Downloads/api.protoset (descriptor set of grpc:// targets, server reflection is used otherwise)",
+		},
+		&cli.StringFlag{
+			Name:  "paginate",
+			Usage: "cursor|link|page|offset (fetch every page of lists, rows can set their own)",
+		},
+		&cli.StringFlag{
+			Name:  "paginate-items",
+			Usage: ".data (jq path of the items of a page)",
+			Value: ".",
+		},
+		&cli.StringFlag{
+			Name:  "paginate-cursor",
+			Usage: ".meta.next_cursor (jq path of the next cursor)",
+			Value: ".next_cursor",
+		},
+		&cli.StringFlag{
+			Name:  "paginate-param",
+			Usage: "page_token (query param of the cursor, page or offset, default: the --paginate type)",
+		},
+		&cli.IntFlag{
+			Name:  "paginate-size",
+			Usage: "100 (a page with fewer items is the last one)",
+		},
+		&cli.IntFlag{
+			Name:  "paginate-max-pages",
+			Usage: "20 (the maximum number of pages per row)",
+			Value: 10,
+		},
+		&cli.StringFlag{
+			Name:  "state",
+			Usage: "~/Downloads/state.json (persist completed rows)",
+		},
+		&cli.StringFlag{
+			Name:  "resume",
+			Usage: "~/Downloads/state.json (skip rows completed by an interrupted run)",
+		},
+		&cli.StringFlag{
+			Name:  "history",
+			Usage: "~/apicmp.db (add the run to a history file, see apicmp history)",
+		},
+		&cli.StringFlag{
+			Name:  "baseline",
+			Usage: "~/Downloads/baseline.yaml (accepted differences, see apicmp baseline update)",
+		},
+	}, targetFlags()...)
+}
+
+func validateDiff(c *cli.Context) error {
+	if c.String("before") == "" {
+		return errors.New("before required")
+	}
+	if c.String("after") == "" {
+		return errors.New("after required")
+	}
+	if c.String("file") == "" && c.String("postman-input") == "" {
+		return errors.New("file required")
+	}
+	if _, ok := validMatches[c.String("match")]; !ok {
+		return errors.New("invalid --match flag")
+	}
+	if _, ok := validFormats[c.String("format")]; c.IsSet("format") && !ok {
+		return errors.New("invalid --format flag")
+	}
+	if _, ok := validPaginateTypes[c.String("paginate")]; c.IsSet("paginate") && !ok {
+		return errors.New("invalid --paginate flag")
+	}
+	if c.IsSet("write-failures") && diff.FixtureFormat(c.String("file"), c.String("format")) == diff.FormatScenario {
+		return errors.New("--write-failures doesn't support scenario files")
+	}
+	sampled := c.IsSet("sample") || c.IsSet("sample-per-route")
+	if sampled && (c.IsSet("rows") || c.IsSet("resume")) && !c.IsSet("seed") {
+		return errors.New("--rows and --resume require --seed with --sample and --sample-per-route")
+	}
+	return nil
+}
+
+// diffConfig returns the Config of diff and baseline update
+func diffConfig(c *cli.Context) diff.Config {
+
+	var ignoreQuerystring *regexp.Regexp
+	if c.IsSet("ignoreQuerystring") {
+		if regex, err := regexp.Compile(c.String("ignoreQuerystring")); err == nil {
+			ignoreQuerystring = regex
+		}
+	}
+
+	fixtureFilePath, fixtureFormat := c.String("file"), c.String("format")
+	if c.IsSet("postman-input") {
+		fixtureFilePath, fixtureFormat = c.String("postman-input"), diff.FormatPostman
+	}
+
+	var paginate *diff.Paginate
+	if c.IsSet("paginate") {
+		paginate = &diff.Paginate{
+			Type:     c.String("paginate"),
+			Items:    c.String("paginate-items"),
+			Cursor:   c.String("paginate-cursor"),
+			Param:    c.String("paginate-param"),
+			Size:     c.Int("paginate-size"),
+			MaxPages: c.Int("paginate-max-pages"),
+		}
+	}
+
+	stateFilePath := c.String("state")
+	if c.IsSet("resume") {
+		stateFilePath = c.String("resume")
+	}
+
+	return diff.Config{
+		BeforeBasePath:     c.String("before"),
+		AfterBasePath:      c.String("after"),
+		CandidateBasePaths: c.StringSlice("candidate"),
+		FixtureFilePath:    fixtureFilePath,
+		FixtureFormat:      fixtureFormat,
+		Headers:            c.StringSlice("header"),
+		QueryStrings:       c.StringSlice("querystring"),
+		IgnoreQueryStrings: ignoreQuerystring,
+		IgnoreFields:       diff.Atoam(c.String("ignore")),
+		Rows:               diff.Atoim(c.String("rows")),
+		Retry:              diff.Atoim(c.String("retry")),
+		Match:              c.String("match"),
+		LogLevel:           c.String("loglevel"),
+		Threads:            c.Int("threads"),
+		PostmanFilePath:    c.String("postman"),
+		PostmanEnvFilePath: c.String("postman-env"),
+		Jq:                 c.String("jq"),
+		StateFilePath:      stateFilePath,
+		Resume:             c.IsSet("resume"),
+		FailuresFilePath:   c.String("write-failures"),
+		OpenAPIFilePath:    c.String("openapi"),
+		Targets:            targetConfigs(c),
+		Sample:             c.Int("sample"),
+		SamplePerRoute:     c.Int("sample-per-route"),
+		Seed:               c.Int64("seed"),
+		Dedupe:             c.Bool("dedupe"),
+		Templates:          c.Bool("templates"),
+		ProtoSetFiles:      c.StringSlice("protoset"),
+		Paginate:           paginate,
+		HistoryFilePath:    c.String("history"),
+		BaselineFilePath:   c.String("baseline"),
+	}
+}
+
+// targetFlags returns the options that can be set for every target with --X,
+// and separately for before and after with --before-X and --after-X
+func targetFlags() []cli.Flag {
+	flags := sideFlags("auth", "~/Downloads/auth.yaml (oauth2, login or command auth)")
+	flags = append(flags, sideFlags("sign", "~/Downloads/sign.yaml (hmac or sigv4 request signing)")...)
+	flags = append(flags, sideFlags("cacert", "~/certs/ca.pem (trust a CA bundle in addition to the system's CAs)")...)
+	flags = append(flags, sideFlags("cert", "~/certs/client.pem (client certificate)")...)
+	flags = append(flags, sideFlags("key", "~/certs/client-key.pem (key of the client certificate)")...)
+	flags = append(flags, sideBoolFlags("insecure", "skip the verification of server certificates")...)
+	flags = append(flags, sideFlags("proxy", "socks5://localhost:1080 (http, https or socks5 proxy)")...)
+	flags = append(flags, sideFlags("protocol", "h1.1|h2|h2c (force HTTP/1.1, HTTP/2 over TLS or cleartext HTTP/2, negotiated by default)")...)
+	flags = append(flags, sideSliceFlags("resolve", "api.example.com:443:127.0.0.1 (connect to an address, keeping the Host header and SNI)")...)
+	return flags
+}
+
+// captureFlags returns the target options without --before-X and --after-X,
+// for commands with a single target
+func captureFlags() []cli.Flag {
+	flags := []cli.Flag{}
+	for _, f := range targetFlags() {
+		name := f.Names()[0]
+		if strings.HasPrefix(name, "before-") || strings.HasPrefix(name, "after-") {
+			continue
+		}
+		flags = append(flags, f)
+	}
+	return flags
+}
+
+func sideFlags(name, usage string) []cli.Flag {
+	return []cli.Flag{
+		&cli.StringFlag{Name: name, Usage: usage},
+		&cli.StringFlag{Name: "before-" + name, Usage: "--" + name + " of before"},
+		&cli.StringFlag{Name: "after-" + name, Usage: "--" + name + " of after"},
+	}
+}
+
+func sideBoolFlags(name, usage string) []cli.Flag {
+	return []cli.Flag{
+		&cli.BoolFlag{Name: name, Usage: usage},
+		&cli.BoolFlag{Name: "before-" + name, Usage: "--" + name + " of before"},
+		&cli.BoolFlag{Name: "after-" + name, Usage: "--" + name + " of after"},
+	}
+}
+
+func sideSliceFlags(name, usage string) []cli.Flag {
+	return []cli.Flag{
+		&cli.StringSliceFlag{Name: name, Usage: usage},
+		&cli.StringSliceFlag{Name: "before-" + name, Usage: "--" + name + " of before"},
+		&cli.StringSliceFlag{Name: "after-" + name, Usage: "--" + name + " of after"},
+	}
+}
+
+// targetConfigs returns the config of every target. Candidates use the
+// options that are set for every target.
+func targetConfigs(c *cli.Context) map[string]diff.TargetConfig {
+	names := []string{"before", "after"}
+	for i := range c.StringSlice("candidate") {
+		names = append(names, "candidate"+strconv.Itoa(i+1))
+	}
+
+	out := make(map[string]diff.TargetConfig, len(names))
+	for _, name := range names {
+		out[name] = diff.TargetConfig{
+			AuthFilePath: sideString(c, name, "auth"),
+			SignFilePath: sideString(c, name, "sign"),
+			CACertFile:   sideString(c, name, "cacert"),
+			CertFile:     sideString(c, name, "cert"),
+			KeyFile:      sideString(c, name, "key"),
+			Insecure:     sideBool(c, name, "insecure"),
+			Proxy:        sideString(c, name, "proxy"),
+			Resolve:      sideStrings(c, name, "resolve"),
+			Protocol:     sideString(c, name, "protocol"),
+		}
+	}
+	return out
+}
+
+// sideString returns --<side>-<name> when it's set, or --<name> otherwise
+func sideString(c *cli.Context, side, name string) string {
+	if c.IsSet(side + "-" + name) {
+		return c.String(side + "-" + name)
+	}
+	return c.String(name)
+}
+
+// sideBool returns --<side>-<name> when it's set, or --<name> otherwise
+func sideBool(c *cli.Context, side, name string) bool {
+	if c.IsSet(side + "-" + name) {
+		return c.Bool(side + "-" + name)
+	}
+	return c.Bool(name)
+}
+
+// sideStrings returns --<side>-<name> when it's set, or --<name> otherwise
+func sideStrings(c *cli.Context, side, name string) []string {
+	if c.IsSet(side + "-" + name) {
+		return c.StringSlice(side + "-" + name)
+	}
+	return c.StringSlice(name)
+}